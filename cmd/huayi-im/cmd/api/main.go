@@ -7,6 +7,7 @@ import (
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/router"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/idgen"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/middleware"
 )
@@ -19,22 +20,29 @@ func main() {
 	logger.Init(cfg.Log)
 	logger.Info("日志初始化成功")
 
-	// 3. 初始化全局管理器
-	manager.Init()
+	// 3. 初始化消息ID生成器
+	if err := idgen.Init(cfg.Server.NodeID); err != nil {
+		logger.Fatal("消息ID生成器初始化失败", logger.Field("error", err))
+	}
+
+	// 4. 初始化全局管理器
+	if err := manager.Init(cfg); err != nil {
+		logger.Fatal("管理器初始化失败", logger.Field("error", err))
+	}
 	logger.Info("管理器初始化成功")
 
-	// 4. 初始化 Gin 引擎
+	// 5. 初始化 Gin 引擎
 	r := gin.Default()
 	// 注册跨域中间件（可选）
 	r.Use(middleware.CorsMiddleware())
-	// 5. 注册路由
+	// 6. 注册路由
 	// 传递 nil 作为 dbInstance，因为我们使用基于内存的用户服务
-	router.Register(r, nil)
+	router.Register(r, cfg, nil)
 	logger.Info("路由注册成功")
 
-	// 6. 启动定时清理过期消息
+	// 7. 启动定时清理过期消息
 	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
+		ticker := time.NewTicker(cfg.Offline.CleanupInterval)
 		defer ticker.Stop()
 
 		for range ticker.C {
@@ -44,7 +52,7 @@ func main() {
 		}
 	}()
 
-	// 7. 启动服务
+	// 8. 启动服务
 	logger.Info("服务启动中，监听地址：", logger.Field("addr", cfg.Server.Addr))
 	if err := r.Run(cfg.Server.Addr); err != nil {
 		logger.Fatal("服务启动失败", logger.Field("error", err))
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
+)
+
+// AdminHandler 管理处理器
+type AdminHandler struct{}
+
+// NewAdminHandler 创建管理处理器实例
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{}
+}
+
+/** GetOfflineQueues 查询离线队列深度
+ * @Summary 查询离线队列深度
+ * @Description 返回离线存储的总量、丢弃/拒绝/过期计数以及各用户的队列深度，仅管理员可访问
+ * @Tags 管理模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param X-Admin-Token header string true "管理接口令牌"
+ * @Success 200 {object} response.Response{data=model.OfflineStats}
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Router /api/admin/offline-queues [get]
+ **/
+func (h *AdminHandler) GetOfflineQueues(c *gin.Context) {
+	response.Success(c, manager.MessageManager.OfflineStats())
+}
+
+/** GetEvictions 查询慢消费者驱逐统计
+ * @Summary 查询慢消费者驱逐统计
+ * @Description 返回服务启动以来按驱逐原因累计的消息数（drop-oldest/drop-newest/disconnect/closed/unacked），仅管理员可访问
+ * @Tags 管理模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param X-Admin-Token header string true "管理接口令牌"
+ * @Success 200 {object} response.Response{data=model.EvictionStats}
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Router /api/admin/evictions [get]
+ **/
+func (h *AdminHandler) GetEvictions(c *gin.Context) {
+	response.Success(c, manager.MessageManager.EvictionStats())
+}
+
+/** GetDispatchStats 查询群聊分发统计
+ * @Summary 查询群聊分发统计
+ * @Description 返回分发器启动以来累计的在线投递、转存离线与丢弃次数，仅管理员可访问
+ * @Tags 管理模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param X-Admin-Token header string true "管理接口令牌"
+ * @Success 200 {object} response.Response{data=model.DeliveryStats}
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Router /api/admin/dispatcher [get]
+ **/
+func (h *AdminHandler) GetDispatchStats(c *gin.Context) {
+	response.Success(c, manager.MessageManager.DispatchStats())
+}
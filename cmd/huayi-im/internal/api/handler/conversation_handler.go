@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/request"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/errno"
+)
+
+// ConversationHandler 会话处理器
+type ConversationHandler struct{}
+
+// NewConversationHandler 创建会话处理器实例
+func NewConversationHandler() *ConversationHandler {
+	return &ConversationHandler{}
+}
+
+/** MarkRead 标记会话已读
+ * @Summary 标记会话已读
+ * @Description 将会话已读位置推进到指定消息，并向消息发送者下发已读回执
+ * @Tags 会话模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param id path string true "会话标识，如 topic:xxx 或 p2p:a,b"
+ * @Param data body request.ReadConversationReq true "已读到的消息ID"
+ * @Success 200 {object} response.Response
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Router /api/conversations/{id}/read [post]
+ **/
+func (h *ConversationHandler) MarkRead(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	var req request.ReadConversationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+		return
+	}
+
+	if err := manager.MessageManager.MarkRead(username.(string), c.Param("id"), req.MessageID); err != nil {
+		response.AbortError(c, readErrno(err))
+		return
+	}
+	response.Success(c, nil)
+}
+
+// readErrno 将已读错误映射为错误码
+func readErrno(err error) errno.Errno {
+	switch {
+	case errors.Is(err, model.ErrMessageNotFound):
+		return errno.NotFound.WithMsg(err.Error())
+	case errors.Is(err, model.ErrNotParticipant):
+		return errno.Forbidden.WithMsg(err.Error())
+	default:
+		return errno.ServerError.WithMsg(err.Error())
+	}
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"log"
-	"time"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/request"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
@@ -13,6 +16,9 @@ import (
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/service"
 )
 
+// defaultMessageListLimit 历史消息每页默认条数
+const defaultMessageListLimit = 50
+
 // MessageHandler 消息处理器
 type MessageHandler struct {
 	userService service.UserService
@@ -27,13 +33,14 @@ func NewMessageHandler(userService service.UserService) *MessageHandler {
 
 /** SendMessage 发送消息
  * @Summary 发送消息
- * @Description 发送单聊或群聊消息
+ * @Description 发送单聊或群聊消息；携带 client-msg-id（或 Idempotency-Key 请求头）时，窗口内的重试返回首次发送的消息ID而不重复投递
  * @Tags 消息模块
  * @Accept json
  * @Produce json
  * @Param Authorization header string true "Bearer session_id"
+ * @Param Idempotency-Key header string false "客户端消息ID，与 body 中的 client-msg-id 等价"
  * @Param data body model.Message true "消息内容"
- * @Success 200 {object} response.Response
+ * @Success 200 {object} response.SendMessageResponse
  * @Failure 10001 {object} response.Response "参数无效"
  * @Failure 20001 {object} response.Response "未授权"
  * @Router /api/messages [post]
@@ -52,10 +59,30 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// 5. 设置发送者和创建时间
+	if msg.TTL < 0 {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("ttl must not be negative"))
+		return
+	}
+
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		if msg.ClientMsgID != "" && msg.ClientMsgID != key {
+			response.AbortError(c, errno.ParamInvalid.WithMsg("client-msg-id does not match Idempotency-Key"))
+			return
+		}
+		msg.ClientMsgID = key
+	}
+
+	// 5. 设置发送者，消息ID、会话序号与创建时间由消息管理器分配
+	msg.ID = 0
 	msg.From = username.(string)
-	msg.CreatedAt = time.Now()
 	msg.MessageType = "message"
+	msg.EditedAt = nil
+	msg.RecalledAt = nil
+	msg.Reactions = nil
+	msg.ThreadRoot = 0
+	msg.Thread = nil
+	msg.Summary = nil
+	msg.Muted = false
 	if msg.Topic != "" {
 		topic, exists := manager.TopicManager.GetTopic(msg.Topic)
 		if !exists { //  topic 不存在，创建并添加发送者和接收者
@@ -82,11 +109,313 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	}
 
 	// 6. 使用消息管理器发送消息
-	if err := manager.MessageManager.SendMessage(&msg); err != nil {
+	sent, err := manager.MessageManager.SendMessage(&msg)
+	if err != nil {
+		if errors.Is(err, model.ErrReplyNotFound) || errors.Is(err, model.ErrReplyMultiRecipient) || errors.Is(err, model.ErrInvalidClientMsgID) {
+			response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+			return
+		}
 		response.AbortError(c, errno.ServerError.WithMsg(err.Error()))
 		return
 	}
 
-	// 7. 返回成功响应
-	response.Success(c, nil)
+	// 7. 返回服务端分配的消息ID与会话序号，重试时为首次发送的消息
+	response.Success(c, newSendMessageResponse(&msg, sent))
+}
+
+// newSendMessageResponse 由实际发出的消息构造发送结果，sent 不是本次请求的 msg 时为窗口内的重试
+func newSendMessageResponse(msg *model.Message, sent []*model.Message) response.SendMessageResponse {
+	first := sent[0]
+	resp := response.SendMessageResponse{
+		ID:             first.ID,
+		ConversationID: first.ConversationID,
+		Seq:            first.Seq,
+		ThreadRoot:     first.ThreadRoot,
+		ClientMsgID:    first.ClientMsgID,
+		Duplicate:      first != msg,
+	}
+	if len(sent) > 1 {
+		for _, m := range sent {
+			resp.Messages = append(resp.Messages, response.SentMessage{
+				To:             m.To[0],
+				ID:             m.ID,
+				ConversationID: m.ConversationID,
+				Seq:            m.Seq,
+			})
+		}
+	}
+	return resp
+}
+
+/** ListMessages 分页获取历史消息
+ * @Summary 分页获取历史消息
+ * @Description 按消息ID从新到旧分页获取群聊或单聊的历史消息，只能读取自己参与的会话
+ * @Tags 消息模块
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param topic query string false "群聊 topic 名称，与 peer 二选一"
+ * @Param peer query string false "单聊对端用户名"
+ * @Param before query int false "只返回ID小于该值的消息，取上一页的 next-before"
+ * @Param limit query int false "每页条数，1-100，默认 50"
+ * @Success 200 {object} response.MessageListResponse
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是会话参与者"
+ * @Router /api/messages [get]
+ **/
+func (h *MessageHandler) ListMessages(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	var req request.ListMessagesReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+		return
+	}
+	if (req.Topic == "") == (req.Peer == "") {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("exactly one of topic and peer is required"))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultMessageListLimit
+	}
+
+	conversationID := model.TopicConversationKey(req.Topic)
+	if req.Peer != "" {
+		if strings.Contains(req.Peer, ",") {
+			response.AbortError(c, errno.ParamInvalid.WithMsg("peer must be a single username"))
+			return
+		}
+		conversationID = model.P2PConversationKey(username.(string), req.Peer)
+	}
+
+	messages, hasMore, err := manager.MessageManager.History(username.(string), conversationID, req.Before, req.Limit)
+	if err != nil {
+		response.AbortError(c, readErrno(err))
+		return
+	}
+
+	resp := response.MessageListResponse{List: messages, HasMore: hasMore}
+	if hasMore {
+		resp.NextBefore = messages[0].ID
+	}
+	response.Success(c, resp)
+}
+
+/** EditMessage 编辑消息
+ * @Summary 编辑消息
+ * @Description 发送者在编辑窗口内修改消息内容，历史与离线队列中的消息被替换，在线参与者收到 message-edited 系统消息
+ * @Tags 消息模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param id path int true "消息ID"
+ * @Param data body request.EditMessageReq true "新的消息内容"
+ * @Success 200 {object} model.Message
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是发送者或已超出编辑窗口"
+ * @Failure 404 {object} response.Response "消息不存在或已撤回"
+ * @Router /api/messages/{id} [patch]
+ **/
+func (h *MessageHandler) EditMessage(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("invalid message id"))
+		return
+	}
+
+	var req request.EditMessageReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+		return
+	}
+
+	msg, err := manager.MessageManager.EditMessage(username.(string), messageID, req.Content)
+	if err != nil {
+		response.AbortError(c, modifyErrno(err))
+		return
+	}
+	response.Success(c, msg)
+}
+
+/** RecallMessage 撤回消息
+ * @Summary 撤回消息
+ * @Description 发送者在撤回窗口内撤回消息，历史与离线队列中的消息被替换为墓碑，在线参与者收到 message-recalled 系统消息
+ * @Tags 消息模块
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param id path int true "消息ID"
+ * @Success 200 {object} model.Message
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是发送者或已超出撤回窗口"
+ * @Failure 404 {object} response.Response "消息不存在或已撤回"
+ * @Router /api/messages/{id} [delete]
+ **/
+func (h *MessageHandler) RecallMessage(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("invalid message id"))
+		return
+	}
+
+	msg, err := manager.MessageManager.RecallMessage(username.(string), messageID)
+	if err != nil {
+		response.AbortError(c, modifyErrno(err))
+		return
+	}
+	response.Success(c, msg)
+}
+
+/** GetThread 分页获取话题串
+ * @Summary 分页获取话题串
+ * @Description 获取话题串的根消息（带回复数与最后回复时间），并按消息ID从新到旧分页获取回复；id 可以是根消息或其中任意一条回复
+ * @Tags 消息模块
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param id path int true "消息ID"
+ * @Param before query int false "只返回ID小于该值的回复，取上一页的 next-before"
+ * @Param limit query int false "每页条数，1-100，默认 50"
+ * @Success 200 {object} response.ThreadResponse
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是会话参与者"
+ * @Failure 404 {object} response.Response "消息不存在"
+ * @Router /api/messages/{id}/thread [get]
+ **/
+func (h *MessageHandler) GetThread(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("invalid message id"))
+		return
+	}
+
+	var req request.ThreadReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultMessageListLimit
+	}
+
+	root, replies, hasMore, err := manager.MessageManager.Thread(username.(string), messageID, req.Before, req.Limit)
+	if err != nil {
+		response.AbortError(c, readErrno(err))
+		return
+	}
+
+	resp := response.ThreadResponse{Root: root, List: replies, HasMore: hasMore}
+	if hasMore {
+		resp.NextBefore = replies[0].ID
+	}
+	response.Success(c, resp)
+}
+
+/** AddReaction 添加表情回应
+ * @Summary 添加表情回应
+ * @Description 会话参与者为消息添加表情回应，重复添加不产生变更；在线参与者收到 reaction 系统消息
+ * @Tags 消息模块
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param id path int true "消息ID"
+ * @Param emoji path string true "表情，需 URL 编码"
+ * @Success 200 {object} model.Message
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是会话参与者"
+ * @Failure 404 {object} response.Response "消息不存在或已撤回"
+ * @Router /api/messages/{id}/reactions/{emoji} [post]
+ **/
+func (h *MessageHandler) AddReaction(c *gin.Context) {
+	h.react(c, model.ReactionAdd)
+}
+
+/** RemoveReaction 取消表情回应
+ * @Summary 取消表情回应
+ * @Description 会话参与者取消自己对消息的表情回应，回应不存在时不产生变更；在线参与者收到 reaction 系统消息
+ * @Tags 消息模块
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param id path int true "消息ID"
+ * @Param emoji path string true "表情，需 URL 编码"
+ * @Success 200 {object} model.Message
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是会话参与者"
+ * @Failure 404 {object} response.Response "消息不存在或已撤回"
+ * @Router /api/messages/{id}/reactions/{emoji} [delete]
+ **/
+func (h *MessageHandler) RemoveReaction(c *gin.Context) {
+	h.react(c, model.ReactionRemove)
+}
+
+// react 添加或取消表情回应，返回以当前用户视角标注 reacted 的消息
+func (h *MessageHandler) react(c *gin.Context, action string) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("invalid message id"))
+		return
+	}
+
+	msg, err := manager.MessageManager.React(username.(string), messageID, c.Param("emoji"), action)
+	if err != nil {
+		response.AbortError(c, reactErrno(err))
+		return
+	}
+	response.Success(c, msg)
+}
+
+// reactErrno 将表情回应错误映射为错误码
+func reactErrno(err error) errno.Errno {
+	switch {
+	case errors.Is(err, model.ErrInvalidReaction), errors.Is(err, model.ErrTooManyReactions):
+		return errno.ParamInvalid.WithMsg(err.Error())
+	case errors.Is(err, model.ErrMessageNotFound), errors.Is(err, model.ErrMessageRecalled):
+		return errno.NotFound.WithMsg(err.Error())
+	case errors.Is(err, model.ErrNotParticipant):
+		return errno.Forbidden.WithMsg(err.Error())
+	default:
+		return errno.ServerError.WithMsg(err.Error())
+	}
+}
+
+// modifyErrno 将编辑、撤回错误映射为错误码
+func modifyErrno(err error) errno.Errno {
+	switch {
+	case errors.Is(err, model.ErrMessageNotFound), errors.Is(err, model.ErrMessageRecalled):
+		return errno.NotFound.WithMsg(err.Error())
+	case errors.Is(err, model.ErrNotSender), errors.Is(err, model.ErrWindowExpired):
+		return errno.Forbidden.WithMsg(err.Error())
+	default:
+		return errno.ServerError.WithMsg(err.Error())
+	}
 }
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/request"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/errno"
+)
+
+// defaultSearchLimit 搜索结果每页默认条数
+const defaultSearchLimit = 20
+
+// SearchHandler 搜索处理器
+type SearchHandler struct{}
+
+// NewSearchHandler 创建搜索处理器实例
+func NewSearchHandler() *SearchHandler {
+	return &SearchHandler{}
+}
+
+/** SearchMessages 搜索历史消息
+ * @Summary 搜索历史消息
+ * @Description 在自己参与的单聊与所在的 topic 中全文搜索历史消息，支持中日韩文字与拉丁文字，结果按时间从新到旧分页
+ * @Tags 搜索模块
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param q query string true "搜索词"
+ * @Param topic query string false "只搜索该 topic 的消息"
+ * @Param from query string false "只搜索该用户发送的消息"
+ * @Param since query string false "只搜索该时间之后的消息，RFC3339 格式"
+ * @Param before query int false "只返回ID小于该值的消息，取上一页的 next-before"
+ * @Param limit query int false "每页条数，1-100，默认 20"
+ * @Success 200 {object} response.SearchMessagesResponse
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Router /api/search/messages [get]
+ **/
+func (h *SearchHandler) SearchMessages(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	var req request.SearchMessagesReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+
+	hits, hasMore, err := manager.MessageManager.SearchMessages(username.(string), model.SearchQuery{
+		Query:  req.Q,
+		Topic:  req.Topic,
+		From:   req.From,
+		Since:  req.Since,
+		Before: req.Before,
+		Limit:  req.Limit,
+	})
+	if err != nil {
+		response.AbortError(c, errno.ServerError.WithMsg(err.Error()))
+		return
+	}
+
+	resp := response.SearchMessagesResponse{List: hits, HasMore: hasMore}
+	if hasMore {
+		resp.NextBefore = hits[len(hits)-1].Message.ID
+	}
+	response.Success(c, resp)
+}
@@ -197,3 +197,65 @@ func (h *TopicHandler) QuitTopic(c *gin.Context) {
 	// 7. 返回响应
 	response.Success(c, nil)
 }
+
+/** MuteTopic 屏蔽话题
+ * @Summary 屏蔽话题
+ * @Description 屏蔽后该话题的普通消息照常投递（离线时照常保存），但标记 muted: true，客户端据此不提示通知；自己参与的话题串中的回复照常提示
+ * @Tags 话题模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param topic path string true "话题名称"
+ * @Success 200 {object} response.Response
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是话题成员"
+ * @Router /api/topics/{topic}/actions/mute [post]
+ **/
+func (h *TopicHandler) MuteTopic(c *gin.Context) {
+	h.setMuted(c, true)
+}
+
+/** UnmuteTopic 取消屏蔽话题
+ * @Summary 取消屏蔽话题
+ * @Description 恢复该话题全部消息的通知提示
+ * @Tags 话题模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param topic path string true "话题名称"
+ * @Success 200 {object} response.Response
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Failure 403 {object} response.Response "不是话题成员"
+ * @Router /api/topics/{topic}/actions/unmute [post]
+ **/
+func (h *TopicHandler) UnmuteTopic(c *gin.Context) {
+	h.setMuted(c, false)
+}
+
+// setMuted 设置当前用户是否屏蔽话题，只有话题成员可以屏蔽
+func (h *TopicHandler) setMuted(c *gin.Context, muted bool) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("username not found in context"))
+		return
+	}
+
+	topicName := c.Param("topic")
+	if topicName == "" {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("topic name is required"))
+		return
+	}
+	if _, exists = manager.TopicManager.GetTopic(topicName); !exists {
+		response.AbortError(c, errno.NotFound.WithMsg("topic not found"))
+		return
+	}
+
+	if !manager.TopicManager.SetMuted(topicName, username.(string), muted) {
+		response.AbortError(c, errno.Forbidden.WithMsg("not a member of the topic"))
+		return
+	}
+
+	response.Success(c, nil)
+}
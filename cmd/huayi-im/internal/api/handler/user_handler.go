@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/request"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/errno"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/service"
 )
@@ -22,15 +23,15 @@ func NewUserHandler(s service.UserService) *UserHandler {
 
 /** GetUserByID 获取用户详情
  * @Summary 获取用户详情
- * @Description 根据用户ID查询用户信息
+ * @Description 根据用户名查询用户信息及当前在线状态
  * @Tags 用户模块
  * @Accept json
  * @Produce json
- * @Param user_id path uint64 true "用户ID"
- * @Success 200 {object} response.Response{data=model.User}
+ * @Param username path string true "用户名"
+ * @Success 200 {object} response.Response{data=response.UserProfileResponse}
  * @Failure 10001 {object} response.Response "参数无效"
  * @Failure 20001 {object} response.Response "用户不存在"
- * @Router /api/v1/users/{user_id} [get]
+ * @Router /api/users/{username} [get]
  **/
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	// 1. 绑定路径参数
@@ -41,7 +42,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 	}
 
 	// 2. 调用业务层
-	user, err := h.userService.GetByUsername(context.Background(), req.Username)
+	user, err := h.userService.GetUserProfile(context.Background(), req.Username)
 	if err != nil {
 		response.AbortError(c, errno.UserNotFound.WithMsg(err.Error()))
 		return
@@ -163,3 +164,96 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 	// 3. 返回响应
 	response.Success(c, users)
 }
+
+/** SubscribePresence 订阅用户在线状态
+ * @Summary 订阅用户在线状态
+ * @Description 订阅后该用户上线、离线时通过 WebSocket 收到 presence 消息，返回当前状态
+ * @Tags 用户模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param username path string true "用户名"
+ * @Success 200 {object} response.Response{data=model.PresenceEvent}
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "用户不存在"
+ * @Router /api/users/{username}/actions/subscribe [post]
+ **/
+func (h *UserHandler) SubscribePresence(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	subject := c.Param("username")
+	if subject == username.(string) {
+		response.AbortError(c, errno.ParamInvalid.WithMsg("cannot subscribe to yourself"))
+		return
+	}
+
+	presence, err := h.userService.GetPresence(context.Background(), subject)
+	if err != nil {
+		response.AbortError(c, errno.UserNotFound.WithMsg(err.Error()))
+		return
+	}
+
+	manager.MessageManager.SubscribePresence(username.(string), subject)
+	response.Success(c, presence)
+}
+
+/** UnsubscribePresence 取消订阅用户在线状态
+ * @Summary 取消订阅用户在线状态
+ * @Description 取消显式订阅；同在某个 Topic 中的成员仍会收到 presence 消息
+ * @Tags 用户模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param username path string true "用户名"
+ * @Success 200 {object} response.Response
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Router /api/users/{username}/actions/unsubscribe [post]
+ **/
+func (h *UserHandler) UnsubscribePresence(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	manager.MessageManager.UnsubscribePresence(username.(string), c.Param("username"))
+	response.Success(c, nil)
+}
+
+/** SetPresence 设置自己的在线状态
+ * @Summary 设置在线状态
+ * @Description 手动设置 away/dnd 及自定义状态文本；online 清除手动状态，由活动时间推导 online/idle
+ * @Tags 用户模块
+ * @Accept json
+ * @Produce json
+ * @Param Authorization header string true "Bearer session_id"
+ * @Param data body request.SetPresenceReq true "在线状态"
+ * @Success 200 {object} response.Response{data=model.PresenceEvent}
+ * @Failure 10001 {object} response.Response "参数无效"
+ * @Failure 20001 {object} response.Response "未授权"
+ * @Router /api/users/me/presence [put]
+ **/
+func (h *UserHandler) SetPresence(c *gin.Context) {
+	username, exists := c.Get("username")
+	if !exists {
+		response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+		return
+	}
+
+	var req request.SetPresenceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+		return
+	}
+
+	presence, err := h.userService.SetPresence(context.Background(), username.(string), req.Status, req.StatusText)
+	if err != nil {
+		response.AbortError(c, errno.ParamInvalid.WithMsg(err.Error()))
+		return
+	}
+	response.Success(c, presence)
+}
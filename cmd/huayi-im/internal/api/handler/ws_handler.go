@@ -3,11 +3,13 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
@@ -26,7 +28,7 @@ var (
 )
 
 // NewWSHandler 创建WebSocket处理器，接受UserService实例
-func NewWSHandler(userService service.UserService) func(c *gin.Context) {
+func NewWSHandler(userService service.UserService, sessionConfig config.SessionConfig, heartbeatConfig config.HeartbeatConfig) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		// 从 query 参数获取 session ID
 		sid := c.Query("sid")
@@ -50,20 +52,31 @@ func NewWSHandler(userService service.UserService) func(c *gin.Context) {
 		defer conn.Close()
 		logger.Info("WebSocket 连接成功", zap.String("username", username), zap.String("sid", sid))
 
-		// 注册连接到消息管理器并接收离线消息
-		manager.MessageManager.RegisterConnection(username, conn)
+		// 注册连接到消息管理器并接收离线消息，之后所有下行帧都经由 wsConn 的发送队列写出
+		// 握手时携带 ack=1 的客户端需逐条确认下行消息，未确认的消息会被重传
+		ack, _ := strconv.ParseBool(c.Query("ack"))
+		wsConn := manager.MessageManager.RegisterConnection(username, sid, conn, ack)
+		if sessionConfig.Policy == config.SessionPolicySingle {
+			// 单会话模式下同一用户只保留当前会话的连接
+			manager.MessageManager.KickOtherSessions(username, sid, "logged in elsewhere")
+		}
+		userService.SetOnlineStatus(c, username, true)
 		defer func() {
-			// 注销连接
-			manager.MessageManager.UnregisterConnection(username)
-			logger.Info("WebSocket 连接关闭", zap.String("username", username))
+			// 注销连接，最后一个设备离开时才标记离线
+			remaining := manager.MessageManager.UnregisterConnection(wsConn)
+			if remaining == 0 {
+				userService.SetOnlineStatus(c, username, false)
+			}
+			logger.Info("WebSocket 连接关闭", zap.String("username", username), zap.String("sid", sid), zap.Int("remaining", remaining))
 		}()
 
+		heartbeat := wsConn.Heartbeat()
 		done := make(chan struct{})
 
 		go func() {
 			defer close(done)
+			// 不设置读超时，连接是否存活由本连接的心跳状态机判定，失活时关闭连接使读取返回
 			for {
-				conn.SetReadDeadline(time.Now().Add(65 * time.Second))
 				messageType, message, err := conn.ReadMessage()
 
 				if err != nil {
@@ -73,6 +86,10 @@ func NewWSHandler(userService service.UserService) func(c *gin.Context) {
 					return
 				}
 
+				// 任何上行帧都视为用户与本连接的活动
+				manager.ActivityTracker.Touch(username)
+				heartbeat.Touch(time.Now())
+
 				switch messageType {
 				case websocket.TextMessage:
 					logger.Info("收到文本消息:", zap.String("username", username), zap.String("message", string(message)))
@@ -89,75 +106,108 @@ func NewWSHandler(userService service.UserService) func(c *gin.Context) {
 							MessageType: "ack",
 							AckID:       wsMsg.MessageID,
 						}
-						if err := conn.WriteJSON(ackMsg); err != nil {
+						if err := wsConn.Send(ackMsg); err != nil {
 							logger.Error("发送ack失败:", zap.Error(err), zap.String("username", username))
 							return
 						}
 					case "ack":
-						conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-						user, err := userService.GetByUsername(c, username)
-						if err != nil {
-							logger.Error("获取用户失败:", zap.Error(err), zap.String("username", username))
-							return
+						// 优先视为对下行聊天消息的确认，否则为 pong 应答
+						if wsMsg.AckID > 0 && wsConn.Ack(uint64(wsMsg.AckID)) {
+							break
 						}
-						if wsMsg.AckID == user.LastAskId {
+						if heartbeat.Ack(wsMsg.AckID) {
 							userService.SetNonResponseCount(c, username, 0)
 						}
+					case "read":
+						// 标记会话已读到 message-id
+						if err := manager.MessageManager.MarkRead(username, wsMsg.ConversationID, uint64(wsMsg.MessageID)); err != nil {
+							logger.Warn("标记已读失败:", zap.Error(err), zap.String("username", username), zap.String("conversation-id", wsMsg.ConversationID))
+						}
+					case "typing":
+						// 正在输入状态只转发给在线成员，不落离线
+						typing := wsMsg.Typing == nil || *wsMsg.Typing
+						if err := manager.MessageManager.Typing(username, wsMsg.To, wsMsg.Topic, typing); err != nil {
+							logger.Warn("转发输入状态失败:", zap.Error(err), zap.String("username", username), zap.String("topic", wsMsg.Topic))
+						}
+					case "reaction":
+						// 对 message-id 添加或取消表情回应，与 POST/DELETE /api/messages/{id}/reactions/{emoji} 等价
+						action := wsMsg.Action
+						if action == "" {
+							action = model.ReactionAdd
+						}
+						if _, err := manager.MessageManager.React(username, uint64(wsMsg.MessageID), wsMsg.Emoji, action); err != nil {
+							logger.Warn("表情回应失败:", zap.Error(err), zap.String("username", username), zap.Int64("message-id", wsMsg.MessageID))
+						}
+					case "presence":
+						// 手动设置在线状态，与 PUT /api/users/me/presence 等价
+						if _, err := userService.SetPresence(c, username, wsMsg.Status, wsMsg.StatusText); err != nil {
+							logger.Warn("设置在线状态失败:", zap.Error(err), zap.String("username", username), zap.String("status", wsMsg.Status))
+						}
 					case "message":
-						logger.Info("收到普通消息:", zap.String("from", wsMsg.From), zap.String("content", wsMsg.Content))
+						logger.Info("收到普通消息:", zap.String("from", username), zap.String("content", wsMsg.Content))
 
+						// 发送者以会话认证的用户为准，忽略帧中的 from，防止冒充他人发送、编辑或占用其 client-msg-id
 						msg := &model.Message{
-							From:        wsMsg.From,
+							From:        username,
 							To:          wsMsg.To,
 							Topic:       wsMsg.Topic,
 							ContentType: wsMsg.ContentType,
 							Content:     wsMsg.Content,
 							MessageType: "message",
-							CreatedAt:   time.Now(),
+							ReplyTo:     uint64(wsMsg.ReplyTo),
+							ClientMsgID: wsMsg.ClientMsgID,
 						}
 
-						if err := manager.MessageManager.SendMessage(msg); err != nil {
-							logger.Error("发送消息失败:", zap.Error(err), zap.String("from", wsMsg.From))
+						sent, err := manager.MessageManager.SendMessage(msg)
+						if err != nil {
+							logger.Error("发送消息失败:", zap.Error(err), zap.String("from", username))
+						}
+						// 下发 sent 回执，携带服务端分配的消息ID与 client-msg-id；重试时为首次发送的结果
+						if len(sent) > 0 {
+							if err := wsConn.Send(model.NewSystemMessage("sent", username, newSendMessageResponse(msg, sent))); err != nil {
+								logger.Error("发送sent回执失败:", zap.Error(err), zap.String("username", username))
+								return
+							}
 						}
-						userService.SetNonResponseCount(c, username, 0)
 					}
 				}
 			}
 		}()
 
-		ticker := time.NewTicker(20 * time.Second)
+		ticker := time.NewTicker(heartbeatConfig.Interval)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-done:
 				return
-			case <-ticker.C:
+			case <-wsConn.Done():
+				return
+			case now := <-ticker.C:
+				pongID, misses, dead := heartbeat.Tick(now)
+				userService.SetNonResponseCount(c, username, misses)
+				// 在线状态中的 idle 随时间推导，每个心跳周期检查一次
+				userService.RefreshPresence(c, username)
+				if dead {
+					// 只关闭当前设备的连接，注销时若已无其他设备则标记 online=false
+					logger.Warn("心跳连续无应答，判定离线", zap.String("username", username), zap.String("sid", sid), zap.Int("misses", misses))
+					wsConn.CloseWithCode(heartbeatConfig.CloseCode, "heartbeat timeout")
+					// 等待关闭帧写出、底层连接关闭后读协程退出，避免 defer 中提前关闭连接
+					<-done
+					return
+				}
+
 				pongMsg := response.WebSocketMessage{
-					MessageID:   time.Now().UnixNano() / 1000000,
+					MessageID:   pongID,
 					From:        "server",
 					To:          []string{username},
 					MessageType: "pong",
 				}
-				if err := conn.WriteJSON(pongMsg); err != nil {
+				if err := wsConn.Send(pongMsg); err != nil {
 					logger.Error("发送心跳包失败:", zap.Error(err), zap.String("username", username))
 					return
 				}
-				time.Sleep(500 * time.Microsecond) // 500ms 间隔
-				user, err := userService.GetByUsername(c, username)
-				if err != nil {
-					logger.Error("获取用户失败:", zap.Error(err), zap.String("username", username))
-					return
-				}
-				userService.SetNonResponseCount(c, username, user.NonResponseCount+1)
-				userService.SetLastAckId(c, username, pongMsg.MessageID)
-				if user.NonResponseCount >= 3 {
-					logger.Error("用户无响应次数超过3次，已被标记为非在线状态", zap.String("username", username))
-					userService.SetOnlineStatus(c, username, false)
-					userService.SetNonResponseCount(c, username, 0)
-					conn.Close()
-					return
-				}
+				userService.SetLastAckId(c, username, pongID)
 			}
 		}
 	}
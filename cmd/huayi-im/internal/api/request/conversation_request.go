@@ -0,0 +1,6 @@
+package request
+
+// ReadConversationReq 标记会话已读请求
+type ReadConversationReq struct {
+	MessageID uint64 `json:"message-id" binding:"required"`
+}
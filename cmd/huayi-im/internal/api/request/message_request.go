@@ -0,0 +1,32 @@
+package request
+
+import "time"
+
+// ListMessagesReq 历史消息分页查询请求，topic 与 peer 二选一
+type ListMessagesReq struct {
+	Topic  string `form:"topic"`                                   // 群聊会话的 topic 名称
+	Peer   string `form:"peer"`                                    // 单聊会话的对端用户名
+	Before uint64 `form:"before"`                                  // 游标：只返回ID小于该值的消息，不传则从最新消息开始
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"` // 每页条数，默认 50
+}
+
+// SearchMessagesReq 历史消息搜索请求
+type SearchMessagesReq struct {
+	Q      string    `form:"q" binding:"required"`                    // 搜索词，多个词之间为“且”的关系
+	Topic  string    `form:"topic"`                                   // 只搜索该 topic 的消息
+	From   string    `form:"from"`                                    // 只搜索该用户发送的消息
+	Since  time.Time `form:"since"`                                   // 只搜索该时间之后的消息，RFC3339 格式
+	Before uint64    `form:"before"`                                  // 游标：只返回ID小于该值的消息，取上一页的 next-before
+	Limit  int       `form:"limit" binding:"omitempty,min=1,max=100"` // 每页条数，默认 20
+}
+
+// EditMessageReq 编辑消息请求
+type EditMessageReq struct {
+	Content string `json:"content" binding:"required"` // 新的消息内容
+}
+
+// ThreadReq 话题串回复分页查询请求
+type ThreadReq struct {
+	Before uint64 `form:"before"`                                  // 游标：只返回ID小于该值的回复，不传则从最新回复开始
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"` // 每页条数，默认 50
+}
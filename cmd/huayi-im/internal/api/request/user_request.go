@@ -5,6 +5,12 @@ type GetUserReq struct {
 	Username string `uri:"username" binding:"required,min=3,max=50"`
 }
 
+// SetPresenceReq 设置在线状态请求，status 为 online 时清除手动状态
+type SetPresenceReq struct {
+	Status     string `json:"status" binding:"required,oneof=online away dnd"`
+	StatusText string `json:"status-text" binding:"max=100"`
+}
+
 // LoginReq 登录请求
 type LoginReq struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
@@ -3,4 +3,3 @@ package request
 type WsRequest struct {
 	Sid string `form:"sid" binding:"required"`
 }
-
@@ -0,0 +1,45 @@
+package response
+
+import "github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
+
+// SendMessageResponse 发送消息响应，单聊发给多个接收者时为首条消息
+type SendMessageResponse struct {
+	ID             uint64 `json:"id"`
+	ConversationID string `json:"conversation-id"`
+	Seq            uint64 `json:"seq"`
+	ThreadRoot     uint64 `json:"thread-root,omitempty"`   // 回复所在话题串的根消息ID
+	ClientMsgID    string `json:"client-msg-id,omitempty"` // 请求携带的客户端消息ID
+	Duplicate      bool   `json:"duplicate,omitempty"`     // 是否为窗口内的重试，此时返回首次发送的结果
+	// Messages 单聊发给多个接收者时按接收者拆分出的全部消息，每条属于发送者与该接收者的会话
+	Messages []SentMessage `json:"messages,omitempty"`
+}
+
+// SentMessage 按接收者拆分出的单聊消息
+type SentMessage struct {
+	To             string `json:"to"`
+	ID             uint64 `json:"id"`
+	ConversationID string `json:"conversation-id"`
+	Seq            uint64 `json:"seq"`
+}
+
+// MessageListResponse 历史消息分页响应
+type MessageListResponse struct {
+	List       []*model.Message `json:"list"`                  // 按消息ID升序排列
+	HasMore    bool             `json:"has-more"`              // 是否还有更早的消息
+	NextBefore uint64           `json:"next-before,omitempty"` // 获取上一页时作为 before 传入
+}
+
+// ThreadResponse 话题串分页响应
+type ThreadResponse struct {
+	Root       *model.Message   `json:"root"`                  // 根消息，带回复统计
+	List       []*model.Message `json:"list"`                  // 回复，按消息ID升序排列
+	HasMore    bool             `json:"has-more"`              // 是否还有更早的回复
+	NextBefore uint64           `json:"next-before,omitempty"` // 获取上一页时作为 before 传入
+}
+
+// SearchMessagesResponse 历史消息搜索响应
+type SearchMessagesResponse struct {
+	List       []*model.SearchHit `json:"list"`                  // 按消息ID从新到旧排列
+	HasMore    bool               `json:"has-more"`              // 是否还有更早的结果
+	NextBefore uint64             `json:"next-before,omitempty"` // 获取下一页时作为 before 传入
+}
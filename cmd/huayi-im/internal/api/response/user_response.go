@@ -1,7 +1,25 @@
 package response
 
+import (
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
+)
+
 type UserResponse struct {
-	Username string `json:"username"`
+	Username     string     `json:"username"`
+	Presence     string     `json:"presence"`                 // online/idle/away/dnd/offline
+	StatusText   string     `json:"status-text,omitempty"`    // 自定义状态文本
+	LastActiveAt *time.Time `json:"last-active-at,omitempty"` // 最后一次活动（HTTP 请求或 WebSocket 上行帧）时间
+	LastSeenAt   *time.Time `json:"last-seen-at,omitempty"`   // 最后在线时间，离线时更新
+}
+
+// UserProfileResponse 用户详情，附带当前在线状态
+type UserProfileResponse struct {
+	*model.User
+	Presence     string     `json:"presence"`
+	StatusText   string     `json:"status-text,omitempty"`
+	LastActiveAt *time.Time `json:"last-active-at,omitempty"`
 }
 
 type UserListResponse struct {
@@ -20,4 +20,19 @@ type WebSocketMessage struct {
 	ContentType string   `json:"content-type,omitempty"`
 	Content     string   `json:"content,omitempty"`
 	AckID       int64    `json:"ack-id,omitempty"`
+	// ConversationID read 帧中标记已读的会话
+	ConversationID string `json:"conversation-id,omitempty"`
+	// Typing typing 帧的输入状态，缺省视为 true
+	Typing *bool `json:"typing,omitempty"`
+	// Status、StatusText presence 帧设置的在线状态与自定义状态文本
+	Status     string `json:"status,omitempty"`
+	StatusText string `json:"status-text,omitempty"`
+	// Emoji、Action reaction 帧对 message-id 添加（add，缺省）或取消（remove）的表情回应
+	Emoji  string `json:"emoji,omitempty"`
+	Action string `json:"action,omitempty"`
+	// ReplyTo message 帧回复的消息ID，消息归入其所在的话题串
+	ReplyTo int64 `json:"reply-to,omitempty"`
+	// ClientMsgID message 帧的客户端消息ID，窗口内重发相同ID的消息不会重复投递；
+	// 每次发送都以 sent 系统消息回执服务端分配的消息ID，重试时为首次发送的结果
+	ClientMsgID string `json:"client-msg-id,omitempty"`
 }
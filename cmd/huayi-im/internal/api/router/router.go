@@ -3,23 +3,27 @@ package router
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/handler"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/middleware"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/service/impl"
 	"gorm.io/gorm"
 )
 
 // Register 注册所有路由
-func Register(r *gin.Engine, dbInstance *gorm.DB) {
+func Register(r *gin.Engine, cfg *config.Config, dbInstance *gorm.DB) {
 	// 初始化依赖（实际项目建议用 wire 依赖注入）
 	// 使用基于内存的用户服务，不依赖数据库
-	userService := impl.NewInMemoryUserService()
+	userService := impl.NewInMemoryUserService(cfg.Session, cfg.Presence)
 	userHandler := handler.NewUserHandler(userService)
 
 	// 初始化其他处理器
 	messageHandler := handler.NewMessageHandler(userService)
 	topicHandler := handler.NewTopicHandler(userService)
+	conversationHandler := handler.NewConversationHandler()
+	searchHandler := handler.NewSearchHandler()
+	adminHandler := handler.NewAdminHandler()
 
-	wsHandler := handler.NewWSHandler(userService)
+	wsHandler := handler.NewWSHandler(userService, cfg.Session, cfg.WS.Heartbeat)
 
 	// 健康检查路由
 	r.GET("/api/healthz", func(c *gin.Context) {
@@ -34,23 +38,48 @@ func Register(r *gin.Engine, dbInstance *gorm.DB) {
 		api.POST("/logout", userHandler.Logout) // 登出
 
 		// 消息模块路由
-		api.POST("/messages", middleware.TokenMiddleware(userService), messageHandler.SendMessage) // 发送消息
+		api.POST("/messages", middleware.TokenMiddleware(userService), messageHandler.SendMessage)                           // 发送消息
+		api.GET("/messages", middleware.TokenMiddleware(userService), messageHandler.ListMessages)                           // 分页获取历史消息
+		api.PATCH("/messages/:id", middleware.TokenMiddleware(userService), messageHandler.EditMessage)                      // 编辑消息
+		api.DELETE("/messages/:id", middleware.TokenMiddleware(userService), messageHandler.RecallMessage)                   // 撤回消息
+		api.POST("/messages/:id/reactions/:emoji", middleware.TokenMiddleware(userService), messageHandler.AddReaction)      // 添加表情回应
+		api.DELETE("/messages/:id/reactions/:emoji", middleware.TokenMiddleware(userService), messageHandler.RemoveReaction) // 取消表情回应
+		api.GET("/messages/:id/thread", middleware.TokenMiddleware(userService), messageHandler.GetThread)                   // 分页获取话题串回复
+
+		// 搜索模块路由
+		api.GET("/search/messages", middleware.TokenMiddleware(userService), searchHandler.SearchMessages) // 搜索历史消息
+
+		// 会话模块路由
+		api.POST("/conversations/:id/read", middleware.TokenMiddleware(userService), conversationHandler.MarkRead) // 标记已读
 
 		// 话题模块路由
 		topicGroup := api.Group("/topics", middleware.TokenMiddleware(userService))
 		{
-			topicGroup.GET("", topicHandler.GetTopics)                      // 获取topic列表
-			topicGroup.POST("", topicHandler.CreateTopic)                   // 创建topic
-			topicGroup.DELETE("/:topic", topicHandler.DeleteTopic)          // 删除topic
-			topicGroup.POST("/:topic/actions/join", topicHandler.JoinTopic) // 显式加入topic
-			topicGroup.POST("/:topic/actions/quit", topicHandler.QuitTopic) // 显式退出topic
+			topicGroup.GET("", topicHandler.GetTopics)                          // 获取topic列表
+			topicGroup.POST("", topicHandler.CreateTopic)                       // 创建topic
+			topicGroup.DELETE("/:topic", topicHandler.DeleteTopic)              // 删除topic
+			topicGroup.POST("/:topic/actions/join", topicHandler.JoinTopic)     // 显式加入topic
+			topicGroup.POST("/:topic/actions/quit", topicHandler.QuitTopic)     // 显式退出topic
+			topicGroup.POST("/:topic/actions/mute", topicHandler.MuteTopic)     // 屏蔽topic消息
+			topicGroup.POST("/:topic/actions/unmute", topicHandler.UnmuteTopic) // 取消屏蔽topic消息
 		}
 
 		// 用户模块路由
 		userGroup := api.Group("/users", middleware.TokenMiddleware(userService))
 		{
-			userGroup.GET("", userHandler.GetUsers)             // 查询用户列表
-			userGroup.GET("/:user_id", userHandler.GetUserByID) // 获取用户详情
+			userGroup.GET("", userHandler.GetUsers)                                           // 查询用户列表
+			userGroup.PUT("/me/presence", userHandler.SetPresence)                            // 设置自己的在线状态
+			userGroup.GET("/:username", userHandler.GetUserByID)                              // 获取用户详情
+			userGroup.POST("/:username/actions/subscribe", userHandler.SubscribePresence)     // 订阅在线状态
+			userGroup.POST("/:username/actions/unsubscribe", userHandler.UnsubscribePresence) // 取消订阅在线状态
+		}
+
+		// 管理模块路由
+		adminGroup := api.Group("/admin", middleware.TokenMiddleware(userService), middleware.AdminMiddleware(cfg.Admin))
+		{
+			adminGroup.GET("/offline-queues", adminHandler.GetOfflineQueues) // 查询离线队列深度
+			adminGroup.GET("/evictions", adminHandler.GetEvictions)          // 查询慢消费者驱逐统计
+			adminGroup.GET("/dispatcher", adminHandler.GetDispatchStats)     // 查询群聊分发统计
 		}
 
 		// WebSocket 路由
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -11,13 +12,112 @@ import (
 
 // Config 全局配置结构体
 type Config struct {
-	Server ServerConfig `yaml:"server" mapstructure:"SERVER"`
-	Log    LogConfig    `yaml:"log" mapstructure:"LOG"`
-	DB     DBConfig     `yaml:"db" mapstructure:"DB"`
-	Redis  RedisConfig  `yaml:"redis" mapstructure:"REDIS"`
-	Admin  AdminConfig  `yaml:"admin" mapstructure:"ADMIN"`
-	Jwt    JWTConfig    `yaml:"jwt" mapstructure:"JWT"`
-	API    APIConfig    `yaml:"api" mapstructure:"API"` // 添加 API 配置
+	Server     ServerConfig     `yaml:"server" mapstructure:"SERVER"`
+	Log        LogConfig        `yaml:"log" mapstructure:"LOG"`
+	DB         DBConfig         `yaml:"db" mapstructure:"DB"`
+	Redis      RedisConfig      `yaml:"redis" mapstructure:"REDIS"`
+	Admin      AdminConfig      `yaml:"admin" mapstructure:"ADMIN"`
+	Jwt        JWTConfig        `yaml:"jwt" mapstructure:"JWT"`
+	API        APIConfig        `yaml:"api" mapstructure:"API"` // 添加 API 配置
+	WS         WSConfig         `yaml:"ws" mapstructure:"WS"`
+	Dispatcher DispatcherConfig `yaml:"dispatcher" mapstructure:"DISPATCHER"`
+	Session    SessionConfig    `yaml:"session" mapstructure:"SESSION"`
+	Presence   PresenceConfig   `yaml:"presence" mapstructure:"PRESENCE"`
+	Offline    OfflineConfig    `yaml:"offline" mapstructure:"OFFLINE"`
+	History    HistoryConfig    `yaml:"history" mapstructure:"HISTORY"`
+	Message    MessageConfig    `yaml:"message" mapstructure:"MESSAGE"`
+	Receipt    ReceiptConfig    `yaml:"receipt" mapstructure:"RECEIPT"`
+	Typing     TypingConfig     `yaml:"typing" mapstructure:"TYPING"`
+}
+
+// 会话策略
+const (
+	SessionPolicySingle = "single" // 新登录踢下线该用户之前的所有会话
+	SessionPolicyMulti  = "multi"  // 会话累积，超过上限时淘汰最早的会话
+)
+
+// SessionConfig 登录会话配置
+type SessionConfig struct {
+	Policy      string `yaml:"policy" mapstructure:"POLICY"`             // single：新登录踢下线旧会话；multi：允许多会话并存
+	MaxSessions int    `yaml:"max_sessions" mapstructure:"MAX_SESSIONS"` // multi 模式下每个用户的最大会话数，超出时淘汰最早的会话
+}
+
+// OfflineConfig 离线消息存储配置，上限为 0 表示不限制
+type OfflineConfig struct {
+	TTL                time.Duration           `yaml:"ttl" mapstructure:"TTL"`                                     // 离线消息的保留时间，消息可通过 ttl 字段缩短
+	CleanupInterval    time.Duration           `yaml:"cleanup_interval" mapstructure:"CLEANUP_INTERVAL"`           // 过期离线消息的清理周期
+	MaxMessagesPerUser int                     `yaml:"max_messages_per_user" mapstructure:"MAX_MESSAGES_PER_USER"` // 每个用户的离线消息条数上限
+	MaxBytesPerUser    int64                   `yaml:"max_bytes_per_user" mapstructure:"MAX_BYTES_PER_USER"`       // 每个用户的离线消息字节数上限
+	MaxMessages        int                     `yaml:"max_messages" mapstructure:"MAX_MESSAGES"`                   // 全局离线消息条数上限
+	MaxBytes           int64                   `yaml:"max_bytes" mapstructure:"MAX_BYTES"`                         // 全局离线消息字节数上限
+	Policy             string                  `yaml:"policy" mapstructure:"POLICY"`                               // drop-oldest/reject
+	SyncBatchSize      int                     `yaml:"sync_batch_size" mapstructure:"SYNC_BATCH_SIZE"`             // 离线回放时每个 batch 帧的消息数上限
+	Compaction         OfflineCompactionConfig `yaml:"compaction" mapstructure:"COMPACTION"`
+	Backend            string                  `yaml:"backend" mapstructure:"BACKEND"`           // memory/disk
+	Dir                string                  `yaml:"dir" mapstructure:"DIR"`                   // disk 后端的段文件目录
+	SegmentSize        int64                   `yaml:"segment_size" mapstructure:"SEGMENT_SIZE"` // disk 后端单个段文件的字节数上限
+}
+
+// OfflineCompactionConfig 离线积压压缩配置
+// 用户在某个 topic 中的离线消息超过阈值时，较早的消息折叠为一条 summary 消息，只保留最近的 threshold 条。
+type OfflineCompactionConfig struct {
+	Threshold int            `yaml:"threshold" mapstructure:"THRESHOLD"` // 所有 topic 的默认阈值，0 表示不压缩
+	Topics    map[string]int `yaml:"topics" mapstructure:"TOPICS"`       // 按 topic 覆盖阈值；配置键不区分大小写
+}
+
+// ThresholdFor 获取 topic 的压缩阈值，0 表示不压缩
+func (c OfflineCompactionConfig) ThresholdFor(topic string) int {
+	if threshold, exists := c.Topics[strings.ToLower(topic)]; exists {
+		return threshold
+	}
+	return c.Threshold
+}
+
+// HistoryConfig 会话历史消息配置
+type HistoryConfig struct {
+	Backend      string `yaml:"backend" mapstructure:"BACKEND"`               // memory/disk
+	Capacity     int    `yaml:"capacity" mapstructure:"CAPACITY"`             // memory 后端每个会话保留的最近消息数
+	Dir          string `yaml:"dir" mapstructure:"DIR"`                       // disk 后端的会话文件目录
+	MaxOpenFiles int    `yaml:"max_open_files" mapstructure:"MAX_OPEN_FILES"` // disk 后端同时打开的会话文件数上限，超过时关闭最久未使用的文件
+}
+
+// MessageConfig 消息编辑、撤回与发送去重配置，时间窗口从消息发送时开始计算
+type MessageConfig struct {
+	EditWindow        time.Duration `yaml:"edit_window" mapstructure:"EDIT_WINDOW"`               // 发送者可编辑消息的时间窗口，0 表示不限制
+	RecallWindow      time.Duration `yaml:"recall_window" mapstructure:"RECALL_WINDOW"`           // 发送者可撤回消息的时间窗口，0 表示不限制
+	IdempotencyWindow time.Duration `yaml:"idempotency_window" mapstructure:"IDEMPOTENCY_WINDOW"` // 按发送者记住 client-msg-id 的时间窗口，0 表示不去重
+}
+
+// PresenceConfig 在线状态配置
+type PresenceConfig struct {
+	IdleAfter time.Duration `yaml:"idle_after" mapstructure:"IDLE_AFTER"` // 在线用户超过该时间无任何活动则为 idle，0 表示不推导 idle
+}
+
+// WSConfig WebSocket 连接配置
+type WSConfig struct {
+	SendQueueSize         int             `yaml:"send_queue_size" mapstructure:"SEND_QUEUE_SIZE"`                   // 每个连接的发送队列容量
+	WriteTimeout          time.Duration   `yaml:"write_timeout" mapstructure:"WRITE_TIMEOUT"`                       // 单帧写超时
+	HighWaterMark         int             `yaml:"high_water_mark" mapstructure:"HIGH_WATER_MARK"`                   // 发送队列高水位，达到后触发慢消费者策略
+	SlowConsumerPolicy    string          `yaml:"slow_consumer_policy" mapstructure:"SLOW_CONSUMER_POLICY"`         // drop-oldest/drop-newest/disconnect
+	SlowConsumerCloseCode int             `yaml:"slow_consumer_close_code" mapstructure:"SLOW_CONSUMER_CLOSE_CODE"` // disconnect 策略使用的关闭码
+	Ack                   AckConfig       `yaml:"ack" mapstructure:"ACK"`
+	Heartbeat             HeartbeatConfig `yaml:"heartbeat" mapstructure:"HEARTBEAT"`
+}
+
+// HeartbeatConfig 业务层心跳配置
+type HeartbeatConfig struct {
+	Interval  time.Duration `yaml:"interval" mapstructure:"INTERVAL"`     // 服务端发送 pong 的间隔
+	MaxMisses int           `yaml:"max_misses" mapstructure:"MAX_MISSES"` // 连续多少个周期无应答且本连接无任何活动（上行帧或同一会话的 HTTP 请求）后判定离线
+	CloseCode int           `yaml:"close_code" mapstructure:"CLOSE_CODE"` // 判定离线时关闭连接使用的关闭码
+}
+
+// AckConfig 下行消息确认与重传配置
+type AckConfig struct {
+	Enabled    bool          `yaml:"enabled" mapstructure:"ENABLED"`         // 是否支持下行消息确认，客户端需在握手时携带 ack=1 才对该连接开启
+	Window     int           `yaml:"window" mapstructure:"WINDOW"`           // 每个连接未确认消息的上限，超出后按慢消费者处理
+	Timeout    time.Duration `yaml:"timeout" mapstructure:"TIMEOUT"`         // 首次重传前的等待时间
+	MaxBackoff time.Duration `yaml:"max_backoff" mapstructure:"MAX_BACKOFF"` // 重传间隔上限（指数退避）
+	MaxRetries int           `yaml:"max_retries" mapstructure:"MAX_RETRIES"` // 最大发送次数，超过后断开连接
 }
 
 // APIConfig API 配置
@@ -37,6 +137,7 @@ type AdminConfig struct {
 	Password string `yaml:"password" mapstructure:"PASSWORD"` // ✅ yaml:"password"
 	Nickname string `yaml:"nickname" mapstructure:"NICKNAME"` // ✅ yaml:"nickname"
 	Email    string `yaml:"email" mapstructure:"EMAIL"`       // ✅ yaml:"email"
+	Token    string `yaml:"token" mapstructure:"TOKEN"`       // 管理接口令牌，请求需携带 X-Admin-Token 头，为空时关闭管理接口
 }
 
 // ServerConfig 服务配置
@@ -44,6 +145,7 @@ type ServerConfig struct {
 	Addr         string        `yaml:"addr" mapstructure:"ADDR"`
 	ReadTimeout  time.Duration `yaml:"read_timeout" mapstructure:"READ_TIMEOUT"`
 	WriteTimeout time.Duration `yaml:"write_timeout" mapstructure:"WRITE_TIMEOUT"`
+	NodeID       int64         `yaml:"node_id" mapstructure:"NODE_ID"` // 消息ID生成器的节点ID（0-15）
 }
 
 // LogConfig 日志配置
@@ -97,6 +199,9 @@ func Load() *Config {
 	viper.AutomaticEnv()      // 自动读取环境变量
 	viper.SetEnvPrefix("APP") // 环境变量前缀：APP_SERVER_ADDR
 	viper.AllowEmptyEnv(true)
+	// 管理令牌不宜写入配置文件，显式绑定环境变量 APP_ADMIN_TOKEN
+	_ = viper.BindEnv("admin.token", "APP_ADMIN_TOKEN")
+	setDefaults()
 
 	// 读取配置文件
 	if err := viper.ReadInConfig(); err != nil {
@@ -124,6 +229,89 @@ func Load() *Config {
 	if err := viper.Unmarshal(&Cfg); err != nil {
 		panic("解析配置失败：" + err.Error())
 	}
+	Cfg.normalize()
 
 	return &Cfg
 }
+
+// ReceiptConfig 已读回执配置
+type ReceiptConfig struct {
+	RecentLimit int `yaml:"recent_limit" mapstructure:"RECENT_LIMIT"` // 每个会话跟踪的最近消息数，更早的消息不支持回执
+}
+
+// TypingConfig 正在输入状态配置
+type TypingConfig struct {
+	TTL         time.Duration `yaml:"ttl" mapstructure:"TTL"`                   // 超过该时间未刷新则自动结束输入状态
+	MinInterval time.Duration `yaml:"min_interval" mapstructure:"MIN_INTERVAL"` // 同一用户同一会话两次转发的最小间隔
+}
+
+// DispatcherConfig 消息分发器配置
+type DispatcherConfig struct {
+	Workers        int           `yaml:"workers" mapstructure:"WORKERS"`                 // worker 数量
+	QueueSize      int           `yaml:"queue_size" mapstructure:"QUEUE_SIZE"`           // 每个 worker 的任务队列容量
+	EnqueueTimeout time.Duration `yaml:"enqueue_timeout" mapstructure:"ENQUEUE_TIMEOUT"` // 队列满时一次扇出的最长等待时间（所有接收者共用）
+}
+
+// 周期类配置的默认值，配置为非正数时同样回退到默认值（time.NewTicker 不接受非正数）
+const (
+	defaultHeartbeatInterval = 20 * time.Second
+	defaultCleanupInterval   = time.Minute
+)
+
+// normalize 将无法使用的配置值回退为默认值并给出提示
+func (c *Config) normalize() {
+	if c.WS.Heartbeat.Interval <= 0 {
+		fmt.Printf("警告：ws.heartbeat.interval 必须大于 0，使用默认值 %s\n", defaultHeartbeatInterval)
+		c.WS.Heartbeat.Interval = defaultHeartbeatInterval
+	}
+	if c.Offline.CleanupInterval <= 0 {
+		fmt.Printf("警告：offline.cleanup_interval 必须大于 0，使用默认值 %s\n", defaultCleanupInterval)
+		c.Offline.CleanupInterval = defaultCleanupInterval
+	}
+}
+
+// setDefaults 设置配置默认值，配置文件与环境变量均未指定时生效
+func setDefaults() {
+	viper.SetDefault("ws.send_queue_size", 256)
+	viper.SetDefault("ws.write_timeout", 10*time.Second)
+	viper.SetDefault("ws.high_water_mark", 192)
+	viper.SetDefault("ws.slow_consumer_policy", "disconnect")
+	viper.SetDefault("ws.slow_consumer_close_code", 1013) // Try Again Later
+	viper.SetDefault("ws.ack.enabled", true)
+	viper.SetDefault("ws.ack.window", 128)
+	viper.SetDefault("ws.ack.timeout", 5*time.Second)
+	viper.SetDefault("ws.ack.max_backoff", 30*time.Second)
+	viper.SetDefault("ws.ack.max_retries", 5)
+	viper.SetDefault("ws.heartbeat.interval", defaultHeartbeatInterval)
+	viper.SetDefault("ws.heartbeat.max_misses", 3)
+	viper.SetDefault("ws.heartbeat.close_code", 4002)
+	viper.SetDefault("session.policy", "multi")
+	viper.SetDefault("session.max_sessions", 5)
+	viper.SetDefault("presence.idle_after", 5*time.Minute)
+	viper.SetDefault("offline.ttl", 10*time.Minute)
+	viper.SetDefault("offline.cleanup_interval", defaultCleanupInterval)
+	viper.SetDefault("offline.max_messages_per_user", 1000)
+	viper.SetDefault("offline.max_bytes_per_user", 1<<20)
+	viper.SetDefault("offline.max_messages", 100000)
+	viper.SetDefault("offline.max_bytes", 64<<20)
+	viper.SetDefault("offline.policy", "drop-oldest")
+	viper.SetDefault("offline.sync_batch_size", 100)
+	viper.SetDefault("offline.compaction.threshold", 0)
+	viper.SetDefault("offline.backend", "memory")
+	viper.SetDefault("offline.dir", "data/offline")
+	viper.SetDefault("offline.segment_size", 16<<20)
+	viper.SetDefault("history.backend", "memory")
+	viper.SetDefault("history.capacity", 1000)
+	viper.SetDefault("history.dir", "data/history")
+	viper.SetDefault("history.max_open_files", 256)
+	viper.SetDefault("message.edit_window", 15*time.Minute)
+	viper.SetDefault("message.recall_window", 2*time.Minute)
+	viper.SetDefault("message.idempotency_window", 10*time.Minute)
+	viper.SetDefault("admin.username", "admin")
+	viper.SetDefault("receipt.recent_limit", 1000)
+	viper.SetDefault("typing.ttl", 5*time.Second)
+	viper.SetDefault("typing.min_interval", time.Second)
+	viper.SetDefault("dispatcher.workers", 8)
+	viper.SetDefault("dispatcher.queue_size", 1024)
+	viper.SetDefault("dispatcher.enqueue_timeout", 100*time.Millisecond)
+}
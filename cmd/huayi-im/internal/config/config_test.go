@@ -0,0 +1,24 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeFallsBackToDefaults(t *testing.T) {
+	cfg := Config{}
+	cfg.WS.Heartbeat.Interval = -time.Second
+	cfg.normalize()
+	if cfg.WS.Heartbeat.Interval != defaultHeartbeatInterval {
+		t.Fatalf("heartbeat interval = %v, want %v", cfg.WS.Heartbeat.Interval, defaultHeartbeatInterval)
+	}
+	if cfg.Offline.CleanupInterval != defaultCleanupInterval {
+		t.Fatalf("cleanup interval = %v, want %v", cfg.Offline.CleanupInterval, defaultCleanupInterval)
+	}
+
+	cfg.WS.Heartbeat.Interval = 5 * time.Second
+	cfg.normalize()
+	if cfg.WS.Heartbeat.Interval != 5*time.Second {
+		t.Fatalf("valid heartbeat interval changed to %v", cfg.WS.Heartbeat.Interval)
+	}
+}
@@ -1,17 +1,31 @@
 package manager
 
 import (
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
 )
 
 // 全局管理器实例
 var (
-	TopicManager   *model.TopicManager
-	MessageManager *model.MessageManager
+	TopicManager    *model.TopicManager
+	MessageManager  *model.MessageManager
+	ActivityTracker *model.ActivityTracker
 )
 
 // Init 初始化管理器
-func Init() {
+func Init(cfg *config.Config) error {
+	offline, err := model.NewOfflineStore(cfg.Offline)
+	if err != nil {
+		return err
+	}
+
+	history, err := model.NewHistoryStore(cfg.History)
+	if err != nil {
+		return err
+	}
+
 	TopicManager = model.NewTopicManager()
-	MessageManager = model.NewMessageManager(TopicManager)
+	MessageManager = model.NewMessageManager(TopicManager, offline, history, cfg)
+	ActivityTracker = model.NewActivityTracker()
+	return nil
 }
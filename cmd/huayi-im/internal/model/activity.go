@@ -0,0 +1,38 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// ActivityTracker 用户活动跟踪器
+// 客户端的任何 HTTP 请求与 WebSocket 上行帧都记为一次活动，
+// 用于推导 idle 状态与离线时的最后在线时间；连接是否存活由各连接的业务心跳单独判定。
+type ActivityTracker struct {
+	lastActive map[string]time.Time
+	mutex      sync.RWMutex
+}
+
+// NewActivityTracker 创建活动跟踪器
+func NewActivityTracker() *ActivityTracker {
+	return &ActivityTracker{
+		lastActive: make(map[string]time.Time),
+	}
+}
+
+// Touch 记录用户的一次活动
+func (at *ActivityTracker) Touch(username string) {
+	now := time.Now()
+	at.mutex.Lock()
+	at.lastActive[username] = now
+	at.mutex.Unlock()
+}
+
+// LastActive 获取用户最后一次活动时间
+func (at *ActivityTracker) LastActive(username string) (time.Time, bool) {
+	at.mutex.RLock()
+	defer at.mutex.RUnlock()
+
+	lastActive, exists := at.lastActive[username]
+	return lastActive, exists
+}
@@ -0,0 +1,452 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrConnectionClosed 连接已关闭
+	ErrConnectionClosed = errors.New("connection closed")
+	// ErrSendQueueFull 发送队列已满
+	ErrSendQueueFull = errors.New("send queue full")
+	// ErrSlowConsumer 连接消费过慢，帧已按策略被驱逐
+	ErrSlowConsumer = errors.New("slow consumer")
+)
+
+// closeFrameTimeout 发送关闭帧的最长等待时间
+const closeFrameTimeout = time.Second
+
+// CloseKicked 会话被踢下线时使用的关闭码
+const CloseKicked = 4001
+
+// closeRequest 写协程收到后发送关闭帧并关闭连接，保证此前入队的帧先写出
+type closeRequest struct {
+	code int
+	text string
+}
+
+// SlowConsumerPolicy 慢消费者处理策略
+type SlowConsumerPolicy string
+
+const (
+	DropOldest SlowConsumerPolicy = "drop-oldest" // 丢弃队列中最早的帧
+	DropNewest SlowConsumerPolicy = "drop-newest" // 丢弃新入队的帧
+	Disconnect SlowConsumerPolicy = "disconnect"  // 以关闭码断开连接
+)
+
+// EvictReason 帧被驱逐的原因
+type EvictReason string
+
+const (
+	EvictDropOldest EvictReason = "drop-oldest"
+	EvictDropNewest EvictReason = "drop-newest"
+	EvictDisconnect EvictReason = "disconnect"
+	EvictClosed     EvictReason = "closed"  // 连接关闭时队列中尚未写出的帧
+	EvictUnacked    EvictReason = "unacked" // 连接关闭时已写出但未被确认的消息
+)
+
+// EvictFunc 帧未能写出时的回调，用于将消息转存离线
+type EvictFunc func(c *Connection, frame interface{}, reason EvictReason)
+
+// DeliveredFunc 聊天消息送达时的回调：开启确认时为收到客户端确认，否则为写协程写出成功
+type DeliveredFunc func(c *Connection, msg *Message)
+
+// ResolveFunc 返回消息的最新版本，入队后被编辑或撤回的消息在写出前替换为新版本
+type ResolveFunc func(msg *Message) *Message
+
+// Connection WebSocket 连接封装
+// gorilla/websocket 不允许并发写，所有下行帧都先进入有界发送队列，
+// 再由唯一的写协程顺序写出；调用方只负责入队，不会被慢连接阻塞。
+// 队列长度达到高水位后按 SlowConsumerPolicy 处理，被驱逐的帧交给 onEvict。
+// 开启确认时，写出的聊天消息进入未确认窗口，超时未确认则按指数退避重传，
+// 连接关闭时仍未确认的消息同样交给 onEvict 转存离线；送达的消息交给 onDelivered。
+// 聊天消息在写出（含重传）前经 resolve 替换为最新版本。
+type Connection struct {
+	Username  string
+	SessionID string
+
+	conn          *websocket.Conn
+	send          chan interface{}
+	space         chan struct{} // 写协程每写出一帧通知一次，供 SendWait 等待队列空间
+	done          chan struct{}
+	closed        bool
+	sendMutex     sync.Mutex
+	closeOnce     sync.Once
+	writeTimeout  time.Duration
+	highWaterMark int
+	policy        SlowConsumerPolicy
+	closeCode     int
+	onEvict       EvictFunc
+	onDelivered   DeliveredFunc
+	resolve       ResolveFunc
+	inflight      *inflightWindow // 未开启确认时为 nil
+	heartbeat     *Heartbeat
+}
+
+// NewConnection 创建连接封装并启动写协程
+func NewConnection(username, sessionID string, conn *websocket.Conn, cfg config.WSConfig, onEvict EvictFunc, onDelivered DeliveredFunc, resolve ResolveFunc) *Connection {
+	highWaterMark := cfg.HighWaterMark
+	if highWaterMark <= 0 || highWaterMark > cfg.SendQueueSize {
+		highWaterMark = cfg.SendQueueSize
+	}
+
+	c := &Connection{
+		Username:      username,
+		SessionID:     sessionID,
+		conn:          conn,
+		send:          make(chan interface{}, cfg.SendQueueSize),
+		space:         make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		writeTimeout:  cfg.WriteTimeout,
+		highWaterMark: highWaterMark,
+		policy:        SlowConsumerPolicy(cfg.SlowConsumerPolicy),
+		closeCode:     cfg.SlowConsumerCloseCode,
+		onEvict:       onEvict,
+		onDelivered:   onDelivered,
+		resolve:       resolve,
+		heartbeat:     NewHeartbeat(cfg.Heartbeat.MaxMisses),
+	}
+	go c.writeLoop()
+	if cfg.Ack.Enabled {
+		c.inflight = newInflightWindow(cfg.Ack)
+		go c.retransmitLoop(cfg.Ack.Timeout)
+	}
+	return c
+}
+
+// Send 将下行帧放入发送队列（非阻塞）
+// 队列达到高水位或未确认窗口已满时按策略处理：drop-oldest 驱逐最早的帧后入队；
+// drop-newest 驱逐当前帧；disconnect 驱逐当前帧并断开连接。
+// 驱逐回调可能转存离线并向发送者的连接下发系统消息，因此总是在释放 sendMutex 后执行。
+func (c *Connection) Send(frame interface{}) error {
+	c.sendMutex.Lock()
+	if c.closed {
+		c.sendMutex.Unlock()
+		return ErrConnectionClosed
+	}
+
+	var evicted interface{}
+	windowFull := c.windowFull(frame)
+	if windowFull || len(c.send) >= c.highWaterMark {
+		switch c.policy {
+		case DropOldest:
+			if windowFull {
+				if oldest := c.inflight.oldest(); oldest != nil {
+					evicted = oldest
+				}
+				break
+			}
+			select {
+			case oldest := <-c.send:
+				evicted = oldest
+			default:
+			}
+		case DropNewest:
+			c.sendMutex.Unlock()
+			c.evict(frame, EvictDropNewest)
+			return ErrSlowConsumer
+		default:
+			c.sendMutex.Unlock()
+			c.evict(frame, EvictDisconnect)
+			c.CloseWithCode(c.closeCode, "slow consumer")
+			return ErrSlowConsumer
+		}
+	}
+
+	var err error
+	select {
+	case c.send <- frame:
+	default:
+		err = ErrSendQueueFull
+	}
+	c.sendMutex.Unlock()
+
+	if evicted != nil {
+		c.evict(evicted, EvictDropOldest)
+	}
+	return err
+}
+
+// Ack 客户端确认下行消息，返回该消息是否在未确认窗口中
+func (c *Connection) Ack(id uint64) bool {
+	if c.inflight == nil {
+		return false
+	}
+	msg := c.inflight.ack(id)
+	if msg == nil {
+		return false
+	}
+	if c.onDelivered != nil {
+		c.onDelivered(c, msg)
+	}
+	return true
+}
+
+// Heartbeat 连接的业务心跳状态机
+func (c *Connection) Heartbeat() *Heartbeat {
+	return c.heartbeat
+}
+
+// windowFull 新的聊天消息入队时未确认窗口是否已满；重传的消息不受限制
+func (c *Connection) windowFull(frame interface{}) bool {
+	msg, ok := frame.(*Message)
+	if !ok || c.inflight == nil {
+		return false
+	}
+	return !c.inflight.contains(msg.ID) && c.inflight.full()
+}
+
+// SendWait 等待队列低于高水位后入队，不触发慢消费者策略
+// 用于离线消息回放等批量下发，避免积压本身把连接判定为慢消费者。
+func (c *Connection) SendWait(frame interface{}, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.sendMutex.Lock()
+		if c.closed {
+			c.sendMutex.Unlock()
+			return ErrConnectionClosed
+		}
+		if len(c.send) < c.highWaterMark {
+			c.send <- frame
+			c.sendMutex.Unlock()
+			return nil
+		}
+		c.sendMutex.Unlock()
+
+		select {
+		case <-c.space:
+		case <-c.done:
+			return ErrConnectionClosed
+		case <-timer.C:
+			return ErrSendQueueFull
+		}
+	}
+}
+
+// SendAndClose 入队最后一帧，写出后再以关闭码关闭连接
+func (c *Connection) SendAndClose(frame interface{}, code int, text string) {
+	if err := c.SendWait(frame, closeFrameTimeout); err != nil {
+		c.CloseWithCode(code, text)
+		return
+	}
+	if err := c.SendWait(closeRequest{code: code, text: text}, closeFrameTimeout); err != nil {
+		c.CloseWithCode(code, text)
+	}
+}
+
+// CloseWithCode 发送关闭帧后关闭连接
+// 连接立即标记为关闭，后续入队直接失败；关闭帧在独立协程中发送，
+// 写协程阻塞在慢连接上时最多等待 closeFrameTimeout，不阻塞调用方。
+func (c *Connection) CloseWithCode(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.shutdown()
+		go func() {
+			deadline := time.Now().Add(closeFrameTimeout)
+			// WriteControl 可与写协程并发调用
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline)
+			c.conn.Close()
+		}()
+		c.drain()
+	})
+}
+
+// Close 关闭连接，可重复调用；队列中尚未写出的帧与未确认的消息交给 onEvict
+func (c *Connection) Close() {
+	c.closeOnce.Do(func() {
+		c.shutdown()
+		c.conn.Close()
+		c.drain()
+	})
+}
+
+// shutdown 标记连接关闭，此后 Send 不再入队
+func (c *Connection) shutdown() {
+	c.sendMutex.Lock()
+	c.closed = true
+	close(c.done)
+	c.sendMutex.Unlock()
+}
+
+// drain 将队列中尚未写出的帧与未确认的消息交给 onEvict
+func (c *Connection) drain() {
+	for {
+		select {
+		case frame := <-c.send:
+			c.evict(frame, EvictClosed)
+		default:
+			if c.inflight != nil {
+				for _, msg := range c.inflight.takeAll() {
+					c.evict(msg, EvictUnacked)
+				}
+			}
+			return
+		}
+	}
+}
+
+// Done 连接关闭时返回的通道
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// evict 驱逐一帧，记录日志并回调
+func (c *Connection) evict(frame interface{}, reason EvictReason) {
+	logger.Warn("驱逐下行帧", zap.String("username", c.Username), zap.String("reason", string(reason)), zap.Int("queued", len(c.send)))
+	if c.inflight != nil {
+		for _, msg := range frameMessages(frame) {
+			c.inflight.remove(msg.ID)
+		}
+	}
+	if c.onEvict != nil {
+		c.onEvict(c, frame, reason)
+	}
+}
+
+// untrack 将写出失败的帧中的消息移出未确认窗口，返回仍需驱逐的部分
+// 写出前已登记的消息可能已被并发的 Close 取走并转存，这部分不再驱逐，避免重复保存离线；
+// 帧中的消息都已被取走时返回 nil。
+func (c *Connection) untrack(frame interface{}) interface{} {
+	messages := frameMessages(frame)
+	if c.inflight == nil || len(messages) == 0 {
+		return frame
+	}
+
+	kept := make([]*Message, 0, len(messages))
+	for _, msg := range messages {
+		if c.inflight.take(msg.ID) {
+			kept = append(kept, msg)
+		}
+	}
+	switch {
+	case len(kept) == 0:
+		return nil
+	case len(kept) == len(messages):
+		return frame
+	default:
+		return NewMessageBatch(kept)
+	}
+}
+
+// latest 将帧中的聊天消息替换为最新版本，没有变化时返回原帧
+func (c *Connection) latest(frame interface{}) interface{} {
+	if c.resolve == nil {
+		return frame
+	}
+	switch f := frame.(type) {
+	case *Message:
+		return c.resolve(f)
+	case *MessageBatch:
+		var messages []*Message
+		for i, msg := range f.Messages {
+			current := c.resolve(msg)
+			if current != msg && messages == nil {
+				messages = slices.Clone(f.Messages)
+			}
+			if messages != nil {
+				messages[i] = current
+			}
+		}
+		if messages == nil {
+			return frame
+		}
+		return NewMessageBatch(messages)
+	default:
+		return frame
+	}
+}
+
+// frameMessages 下行帧中需要确认的聊天消息
+func frameMessages(frame interface{}) []*Message {
+	switch f := frame.(type) {
+	case *Message:
+		return []*Message{f}
+	case *MessageBatch:
+		return f.Messages
+	default:
+		return nil
+	}
+}
+
+// writeLoop 写协程，连接上唯一调用 WriteJSON 的地方
+func (c *Connection) writeLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case frame := <-c.send:
+			if req, ok := frame.(closeRequest); ok {
+				c.CloseWithCode(req.code, req.text)
+				return
+			}
+
+			frame = c.latest(frame)
+			if c.inflight != nil {
+				// 写出前登记，避免确认先于登记到达
+				for _, msg := range frameMessages(frame) {
+					c.inflight.track(msg)
+				}
+			}
+
+			c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+			if err := c.conn.WriteJSON(frame); err != nil {
+				logger.Error("写入WebSocket消息失败:", zap.Error(err), zap.String("username", c.Username))
+				if remaining := c.untrack(frame); remaining != nil {
+					c.evict(remaining, EvictClosed)
+				}
+				c.Close()
+				return
+			}
+			if c.inflight == nil && c.onDelivered != nil {
+				// 未开启确认时以写出成功视为送达
+				for _, msg := range frameMessages(frame) {
+					c.onDelivered(c, msg)
+				}
+			}
+
+			select {
+			case c.space <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// retransmitLoop 重传协程，定期重发超时未确认的消息；发送次数耗尽时断开连接
+func (c *Connection) retransmitLoop(timeout time.Duration) {
+	interval := timeout / 5
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			retry, exhausted := c.inflight.due(now)
+			if exhausted {
+				logger.Warn("消息重传次数耗尽，断开连接", zap.String("username", c.Username), zap.String("sid", c.SessionID))
+				c.CloseWithCode(c.closeCode, "ack timeout")
+				return
+			}
+			for _, msg := range retry {
+				logger.Info("重传未确认消息", zap.String("username", c.Username), zap.Uint64("id", msg.ID))
+				if err := c.Send(msg); err != nil {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+// evictRecord 记录一次驱逐
+type evictRecord struct {
+	id     uint64
+	reason EvictReason
+}
+
+// evictRecorder 收集连接的驱逐回调
+type evictRecorder struct {
+	mutex   sync.Mutex
+	records []evictRecord
+}
+
+func (r *evictRecorder) onEvict(c *Connection, frame interface{}, reason EvictReason) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, msg := range frameMessages(frame) {
+		r.records = append(r.records, evictRecord{id: msg.ID, reason: reason})
+	}
+}
+
+func (r *evictRecorder) snapshot() []evictRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]evictRecord(nil), r.records...)
+}
+
+// stalledConnection 创建写协程阻塞在第一条消息上的连接，release 后恢复写出
+func stalledConnection(t *testing.T, cfg config.WSConfig, recorder *evictRecorder) (c *Connection, release func()) {
+	t.Helper()
+	entered := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	var once sync.Once
+	release = func() { once.Do(func() { close(unblock) }) }
+	t.Cleanup(release)
+
+	resolve := func(msg *Message) *Message {
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-unblock
+		return msg
+	}
+	c = NewConnection("alice", "s1", dialTestConn(t), cfg, recorder.onEvict, nil, resolve)
+	t.Cleanup(c.Close)
+
+	if err := c.Send(&Message{ID: 1}); err != nil {
+		t.Fatalf("Send(1) = %v", err)
+	}
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("write loop did not pick up the first frame")
+	}
+	return c, release
+}
+
+func slowConsumerConfig(policy SlowConsumerPolicy) config.WSConfig {
+	return config.WSConfig{
+		SendQueueSize:         2,
+		WriteTimeout:          time.Second,
+		SlowConsumerPolicy:    string(policy),
+		SlowConsumerCloseCode: 4008,
+	}
+}
+
+func TestConnectionDropOldest(t *testing.T) {
+	recorder := &evictRecorder{}
+	c, _ := stalledConnection(t, slowConsumerConfig(DropOldest), recorder)
+
+	// 队列已满时驱逐最早入队的帧，新帧照常入队
+	for id := uint64(2); id <= 4; id++ {
+		if err := c.Send(&Message{ID: id}); err != nil {
+			t.Fatalf("Send(%d) = %v, want nil", id, err)
+		}
+	}
+	if got := recorder.snapshot(); len(got) != 1 || got[0] != (evictRecord{2, EvictDropOldest}) {
+		t.Fatalf("evicted = %v, want [{2 drop-oldest}]", got)
+	}
+	if len(c.send) != 2 {
+		t.Fatalf("queued = %d, want 2", len(c.send))
+	}
+}
+
+func TestConnectionDropNewest(t *testing.T) {
+	recorder := &evictRecorder{}
+	c, _ := stalledConnection(t, slowConsumerConfig(DropNewest), recorder)
+
+	c.Send(&Message{ID: 2})
+	c.Send(&Message{ID: 3})
+	if err := c.Send(&Message{ID: 4}); !errors.Is(err, ErrSlowConsumer) {
+		t.Fatalf("Send(4) = %v, want %v", err, ErrSlowConsumer)
+	}
+	if got := recorder.snapshot(); len(got) != 1 || got[0] != (evictRecord{4, EvictDropNewest}) {
+		t.Fatalf("evicted = %v, want [{4 drop-newest}]", got)
+	}
+}
+
+func TestConnectionDisconnectSlowConsumer(t *testing.T) {
+	recorder := &evictRecorder{}
+	c, release := stalledConnection(t, slowConsumerConfig(Disconnect), recorder)
+
+	c.Send(&Message{ID: 2})
+	c.Send(&Message{ID: 3})
+	if err := c.Send(&Message{ID: 4}); !errors.Is(err, ErrSlowConsumer) {
+		t.Fatalf("Send(4) = %v, want %v", err, ErrSlowConsumer)
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("connection not closed after disconnect policy")
+	}
+	if err := c.Send(&Message{ID: 5}); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Send after close = %v, want %v", err, ErrConnectionClosed)
+	}
+
+	// 当前帧按 disconnect 驱逐，队列中的帧在关闭时驱逐
+	want := []evictRecord{{4, EvictDisconnect}, {2, EvictClosed}, {3, EvictClosed}}
+	got := recorder.snapshot()
+	if len(got) != len(want) {
+		t.Fatalf("evicted = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("evicted = %v, want %v", got, want)
+		}
+	}
+	release()
+}
+
+func TestConnectionSendWaitSkipsPolicy(t *testing.T) {
+	recorder := &evictRecorder{}
+	c, _ := stalledConnection(t, slowConsumerConfig(Disconnect), recorder)
+
+	c.Send(&Message{ID: 2})
+	c.Send(&Message{ID: 3})
+	// 队列满时 SendWait 等待超时，不驱逐也不断开
+	if err := c.SendWait(&Message{ID: 4}, 50*time.Millisecond); !errors.Is(err, ErrSendQueueFull) {
+		t.Fatalf("SendWait = %v, want %v", err, ErrSendQueueFull)
+	}
+	if got := recorder.snapshot(); len(got) != 0 {
+		t.Fatalf("evicted = %v, want none", got)
+	}
+	select {
+	case <-c.Done():
+		t.Fatal("connection closed by SendWait")
+	default:
+	}
+}
+
+func ackConfig(timeout time.Duration, maxRetries int) config.WSConfig {
+	return config.WSConfig{
+		SendQueueSize: 16,
+		WriteTimeout:  time.Second,
+		Ack:           config.AckConfig{Enabled: true, Window: 16, Timeout: timeout, MaxBackoff: 2 * timeout, MaxRetries: maxRetries},
+	}
+}
+
+// waitInflight 等待写协程将消息登记到未确认窗口
+func waitInflight(t *testing.T, c *Connection, id uint64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !c.inflight.contains(id) {
+		if time.Now().After(deadline) {
+			t.Fatalf("message %d not in flight", id)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConnectionAckDelivers(t *testing.T) {
+	var delivered []uint64
+	onDelivered := func(c *Connection, msg *Message) { delivered = append(delivered, msg.ID) }
+	recorder := &evictRecorder{}
+	c := NewConnection("alice", "s1", dialTestConn(t), ackConfig(time.Minute, 3), recorder.onEvict, onDelivered, nil)
+
+	c.Send(&Message{ID: 1})
+	c.Send(&Message{ID: 2})
+	waitInflight(t, c, 1)
+	waitInflight(t, c, 2)
+
+	// 写出成功不算送达，收到确认才回调
+	if len(delivered) != 0 {
+		t.Fatalf("delivered before ack = %v, want none", delivered)
+	}
+	if !c.Ack(1) || c.Ack(1) {
+		t.Fatal("Ack(1) should succeed exactly once")
+	}
+	if len(delivered) != 1 || delivered[0] != 1 {
+		t.Fatalf("delivered = %v, want [1]", delivered)
+	}
+
+	// 关闭时仍未确认的消息交给 onEvict
+	c.Close()
+	if got := recorder.snapshot(); len(got) != 1 || got[0] != (evictRecord{2, EvictUnacked}) {
+		t.Fatalf("evicted = %v, want [{2 unacked}]", got)
+	}
+}
+
+func TestConnectionRetransmitUntilExhausted(t *testing.T) {
+	var (
+		mutex  sync.Mutex
+		writes int
+	)
+	resolve := func(msg *Message) *Message {
+		mutex.Lock()
+		writes++
+		mutex.Unlock()
+		return msg
+	}
+	recorder := &evictRecorder{}
+	c := NewConnection("alice", "s1", dialTestConn(t), ackConfig(100*time.Millisecond, 2), recorder.onEvict, nil, resolve)
+	t.Cleanup(c.Close)
+
+	c.Send(&Message{ID: 1})
+	// 超时未确认则重传，发送次数耗尽后断开连接，未确认的消息交给 onEvict
+	deadline := time.Now().Add(3 * time.Second)
+	for len(recorder.snapshot()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("unacked message not evicted after retries exhausted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := recorder.snapshot(); len(got) != 1 || got[0] != (evictRecord{1, EvictUnacked}) {
+		t.Fatalf("evicted = %v, want [{1 unacked}]", got)
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("connection not closed after retries exhausted")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if writes != 2 {
+		t.Fatalf("writes = %d, want 2", writes)
+	}
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DeliveryOutcome 单个接收者的投递结果
+type DeliveryOutcome int
+
+const (
+	DeliveredOnline DeliveryOutcome = iota // 已放入在线连接的发送队列
+	QueuedOffline                          // 已保存为离线消息
+	Dropped                                // 投递失败被丢弃
+)
+
+// DeliverFunc 向单个接收者投递消息
+type DeliverFunc func(username string, msg *Message) DeliveryOutcome
+
+// DeliveryStats 投递统计
+type DeliveryStats struct {
+	Online  int64 `json:"online"`
+	Offline int64 `json:"offline"`
+	Dropped int64 `json:"dropped"`
+}
+
+// deliveryCounter 并发安全的投递计数
+type deliveryCounter struct {
+	online  atomic.Int64
+	offline atomic.Int64
+	dropped atomic.Int64
+}
+
+func (dc *deliveryCounter) add(outcome DeliveryOutcome) {
+	switch outcome {
+	case DeliveredOnline:
+		dc.online.Add(1)
+	case QueuedOffline:
+		dc.offline.Add(1)
+	default:
+		dc.dropped.Add(1)
+	}
+}
+
+func (dc *deliveryCounter) snapshot() DeliveryStats {
+	return DeliveryStats{
+		Online:  dc.online.Load(),
+		Offline: dc.offline.Load(),
+		Dropped: dc.dropped.Load(),
+	}
+}
+
+// fanout 一条消息的扇出过程，最后一个接收者处理完成时输出统计
+type fanout struct {
+	msg       *Message
+	stats     deliveryCounter
+	remaining atomic.Int64
+}
+
+// deliveryJob 投递任务：一条消息对一个接收者
+type deliveryJob struct {
+	recipient string
+	fanout    *fanout
+}
+
+// Dispatcher 消息分发器
+// 每个 worker 拥有独立的有界任务队列，任务按接收者哈希分片，
+// 保证同一接收者的消息按提交顺序投递，不同接收者之间并发投递。
+type Dispatcher struct {
+	queues         []chan deliveryJob
+	deliver        DeliverFunc
+	overflow       DeliverFunc // 任务无法入队时的兜底投递（如转存离线）
+	enqueueTimeout time.Duration
+	totals         deliveryCounter
+}
+
+// NewDispatcher 创建分发器并启动 worker
+// workers、queueSize 未配置或非法时使用默认值。
+func NewDispatcher(cfg config.DispatcherConfig, deliver, overflow DeliverFunc) *Dispatcher {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 8
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+
+	d := &Dispatcher{
+		queues:         make([]chan deliveryJob, workers),
+		deliver:        deliver,
+		overflow:       overflow,
+		enqueueTimeout: cfg.EnqueueTimeout,
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan deliveryJob, queueSize)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+// Dispatch 将消息扇出给所有接收者，不等待投递完成
+// 在会话锁内调用：整次扇出共用一个 enqueueTimeout 的等待期限，期限过后队列已满的分片直接转入兜底处理，
+// 发送者最多被阻塞 enqueueTimeout，与接收者数量无关。
+func (d *Dispatcher) Dispatch(msg *Message, recipients []string) {
+	if len(recipients) == 0 {
+		return
+	}
+
+	f := &fanout{msg: msg}
+	f.remaining.Store(int64(len(recipients)))
+
+	var deadline *time.Timer
+	expired := false
+	for _, recipient := range recipients {
+		job := deliveryJob{recipient: recipient, fanout: f}
+		queue := d.queues[d.shard(recipient)]
+
+		select {
+		case queue <- job:
+			continue
+		default:
+		}
+		if !expired {
+			if deadline == nil {
+				deadline = time.NewTimer(d.enqueueTimeout)
+				defer deadline.Stop()
+			}
+			select {
+			case queue <- job:
+				continue
+			case <-deadline.C:
+				expired = true
+			}
+		}
+
+		logger.Warn("分发队列已满，投递任务转入兜底处理", zap.String("to", recipient), zap.String("from", msg.From), zap.String("topic", msg.Topic))
+		d.finish(job, d.overflow(recipient, msg))
+	}
+}
+
+// Stats 返回分发器启动以来的累计投递统计
+func (d *Dispatcher) Stats() DeliveryStats {
+	return d.totals.snapshot()
+}
+
+// shard 计算接收者所在的分片
+func (d *Dispatcher) shard(recipient string) int {
+	h := fnv.New32a()
+	h.Write([]byte(recipient))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// work worker 主循环
+func (d *Dispatcher) work(queue <-chan deliveryJob) {
+	for job := range queue {
+		d.finish(job, d.deliver(job.recipient, job.fanout.msg))
+	}
+}
+
+// finish 记录单个投递结果，扇出全部完成时输出统计
+func (d *Dispatcher) finish(job deliveryJob, outcome DeliveryOutcome) {
+	d.totals.add(outcome)
+	job.fanout.stats.add(outcome)
+	if job.fanout.remaining.Add(-1) > 0 {
+		return
+	}
+
+	stats := job.fanout.stats.snapshot()
+	msg := job.fanout.msg
+	logger.Info("消息扇出完成",
+		zap.String("from", msg.From),
+		zap.String("topic", msg.Topic),
+		zap.Int64("online", stats.Online),
+		zap.Int64("offline", stats.Offline),
+		zap.Int64("dropped", stats.Dropped),
+	)
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+func TestDispatcherDefaults(t *testing.T) {
+	d := NewDispatcher(config.DispatcherConfig{Workers: -1}, nil, nil)
+	if len(d.queues) != 8 || cap(d.queues[0]) != 1024 {
+		t.Fatalf("workers = %d, queue size = %d, want 8 and 1024", len(d.queues), cap(d.queues[0]))
+	}
+}
+
+func TestDispatcherPreservesOrderPerRecipient(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		received = make(map[string][]uint64)
+		wg       sync.WaitGroup
+	)
+	deliver := func(username string, msg *Message) DeliveryOutcome {
+		mutex.Lock()
+		received[username] = append(received[username], msg.ID)
+		mutex.Unlock()
+		wg.Done()
+		return DeliveredOnline
+	}
+	d := NewDispatcher(config.DispatcherConfig{Workers: 4, QueueSize: 16, EnqueueTimeout: time.Second}, deliver, nil)
+
+	recipients := []string{"alice", "bob", "carol", "dave", "erin"}
+	const messages = 50
+	wg.Add(messages * len(recipients))
+	for id := uint64(1); id <= messages; id++ {
+		d.Dispatch(&Message{ID: id}, recipients)
+	}
+	wg.Wait()
+
+	// 同一接收者的消息按提交顺序投递
+	for _, user := range recipients {
+		got := received[user]
+		if len(got) != messages {
+			t.Fatalf("%s received %d messages, want %d", user, len(got), messages)
+		}
+		for i, id := range got {
+			if id != uint64(i+1) {
+				t.Fatalf("%s received %v, want ascending order", user, got)
+			}
+		}
+	}
+	if stats := d.Stats(); stats.Online != messages*int64(len(recipients)) {
+		t.Fatalf("stats = %+v, want all online", stats)
+	}
+}
+
+func TestDispatcherBoundsWaitWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	deliver := func(string, *Message) DeliveryOutcome {
+		<-release
+		return DeliveredOnline
+	}
+	var overflowed sync.Map
+	overflow := func(username string, msg *Message) DeliveryOutcome {
+		overflowed.Store(username, true)
+		return QueuedOffline
+	}
+	const timeout = 50 * time.Millisecond
+	d := NewDispatcher(config.DispatcherConfig{Workers: 1, QueueSize: 1, EnqueueTimeout: timeout}, deliver, overflow)
+	defer close(release)
+
+	// worker 阻塞在第一个任务上，队列只能再容纳一个，其余接收者共用一次等待期限
+	recipients := make([]string, 20)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("user%d", i)
+	}
+	start := time.Now()
+	d.Dispatch(&Message{ID: 1}, recipients)
+	if elapsed := time.Since(start); elapsed > 5*timeout {
+		t.Fatalf("Dispatch blocked for %v, want about %v in total", elapsed, timeout)
+	}
+
+	if stats := d.Stats(); stats.Offline < int64(len(recipients))-2 {
+		t.Fatalf("stats = %+v, want at least %d overflowed", stats, len(recipients)-2)
+	}
+	if _, exists := overflowed.Load(recipients[len(recipients)-1]); !exists {
+		t.Fatal("last recipient not handed to overflow")
+	}
+}
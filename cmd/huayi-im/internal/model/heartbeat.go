@@ -0,0 +1,85 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// Heartbeat 连接级业务心跳状态机
+// 每个心跳周期调用一次 Tick：上个周期以来本连接有任何活动（本连接的上行帧、同一会话的 HTTP 请求）则清零未应答计数；
+// 否则只要仍有未应答的 pong，未应答计数加一。计数达到上限判定连接失活，否则发出新的 pong。
+// 活动按连接记录，同一用户在其他设备上的活动不会让半开的连接一直保留。
+type Heartbeat struct {
+	maxMisses   int
+	outstanding map[int64]struct{} // 已发出、尚未应答的 pong ID
+	misses      int
+	lastActive  time.Time // 本连接最后一次活动的时间
+	lastTick    time.Time
+	mutex       sync.Mutex
+}
+
+// NewHeartbeat 创建心跳状态机
+func NewHeartbeat(maxMisses int) *Heartbeat {
+	return &Heartbeat{
+		maxMisses:   maxMisses,
+		outstanding: make(map[int64]struct{}),
+		lastTick:    time.Now(),
+	}
+}
+
+// Ack 客户端应答 pong，返回该 ID 是否为未应答的 pong
+// 应答清零未应答计数，同时清除该 ID 及更早的未应答 pong。
+func (h *Heartbeat) Ack(id int64) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, exists := h.outstanding[id]; !exists {
+		return false
+	}
+	for pongID := range h.outstanding {
+		if pongID <= id {
+			delete(h.outstanding, pongID)
+		}
+	}
+	h.misses = 0
+	return true
+}
+
+// Touch 记录本连接的一次活动
+func (h *Heartbeat) Touch(now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if now.After(h.lastActive) {
+		h.lastActive = now
+	}
+}
+
+// Tick 推进一个心跳周期
+// 返回本周期要发出的 pong ID、当前未应答次数以及连接是否已失活。
+func (h *Heartbeat) Tick(now time.Time) (pongID int64, misses int, dead bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.lastActive.After(h.lastTick) {
+		h.misses = 0
+		clear(h.outstanding)
+	} else if len(h.outstanding) > 0 {
+		h.misses++
+	}
+	h.lastTick = now
+
+	if h.maxMisses > 0 && h.misses >= h.maxMisses {
+		return 0, h.misses, true
+	}
+
+	pongID = now.UnixMilli()
+	for {
+		if _, exists := h.outstanding[pongID]; !exists {
+			break
+		}
+		pongID++
+	}
+	h.outstanding[pongID] = struct{}{}
+	return pongID, h.misses, false
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatMissesUntilDead(t *testing.T) {
+	h := NewHeartbeat(3)
+	now := time.Now()
+
+	// 第一个周期没有未应答的 pong，不计入未应答
+	if _, misses, dead := h.Tick(now); misses != 0 || dead {
+		t.Fatalf("first Tick: misses = %d, dead = %v", misses, dead)
+	}
+	for i := 1; i <= 2; i++ {
+		now = now.Add(time.Second)
+		if _, misses, dead := h.Tick(now); misses != i || dead {
+			t.Fatalf("Tick #%d: misses = %d, dead = %v", i, misses, dead)
+		}
+	}
+	now = now.Add(time.Second)
+	if _, misses, dead := h.Tick(now); misses != 3 || !dead {
+		t.Fatalf("third miss: misses = %d, dead = %v, want dead", misses, dead)
+	}
+}
+
+func TestHeartbeatAckResetsMisses(t *testing.T) {
+	h := NewHeartbeat(3)
+	now := time.Now()
+	first, _, _ := h.Tick(now)
+	now = now.Add(time.Second)
+	second, misses, _ := h.Tick(now)
+	if misses != 1 {
+		t.Fatalf("misses = %d, want 1", misses)
+	}
+
+	// 应答清除该 ID 及更早的 pong
+	if !h.Ack(second) {
+		t.Fatal("Ack(second) = false")
+	}
+	if h.Ack(first) {
+		t.Fatal("Ack(first) = true after a later pong was acknowledged")
+	}
+	if h.Ack(12345) {
+		t.Fatal("Ack(unknown) = true")
+	}
+	now = now.Add(time.Second)
+	if _, misses, _ := h.Tick(now); misses != 0 {
+		t.Fatalf("misses after Ack = %d, want 0", misses)
+	}
+}
+
+func TestHeartbeatTouchCountsAsActivity(t *testing.T) {
+	h := NewHeartbeat(2)
+	now := time.Now()
+	h.Tick(now)
+	now = now.Add(time.Second)
+	h.Tick(now)
+
+	// 两个周期之间本连接有活动时清零
+	h.Touch(now.Add(500 * time.Millisecond))
+	now = now.Add(time.Second)
+	if _, misses, dead := h.Tick(now); misses != 0 || dead {
+		t.Fatalf("Tick after Touch: misses = %d, dead = %v", misses, dead)
+	}
+
+	// 早于上个周期的活动不计入
+	h.Touch(now.Add(-time.Minute))
+	now = now.Add(time.Second)
+	if _, misses, _ := h.Tick(now); misses != 1 {
+		t.Fatalf("Tick after stale Touch: misses = %d, want 1", misses)
+	}
+}
+
+func TestHeartbeatPongIDsUnique(t *testing.T) {
+	h := NewHeartbeat(0)
+	now := time.Now()
+	seen := make(map[int64]bool)
+	// 同一毫秒内的多个周期也分配不同的 pong ID；max_misses 为 0 时永不判定失活
+	for i := 0; i < 10; i++ {
+		id, _, dead := h.Tick(now)
+		if seen[id] || dead {
+			t.Fatalf("Tick #%d: id = %d (seen %v), dead = %v", i, id, seen[id], dead)
+		}
+		seen[id] = true
+	}
+}
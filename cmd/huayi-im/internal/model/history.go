@@ -0,0 +1,147 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+// 历史消息存储后端
+const (
+	HistoryBackendMemory = "memory" // 每个会话保留最近 capacity 条，进程重启后丢失
+	HistoryBackendDisk   = "disk"   // 每个会话一个追加写入的文件，保留全部历史
+)
+
+// HistoryStore 会话历史消息存储
+type HistoryStore interface {
+	// Append 记录会话中的一条消息；同一ID再次写入时覆盖之前的版本
+	// 返回因容量限制被淘汰的消息，没有淘汰时为 nil。
+	Append(msg *Message) (*Message, error)
+	// Get 按消息ID获取消息，消息不存在或已被淘汰时返回 false
+	Get(id uint64) (*Message, bool, error)
+	// Before 按消息ID向前分页：返回ID小于 before（为 0 时不限）的最近 limit 条消息，按ID升序排列，以及是否还有更早的消息
+	Before(conversationID string, before uint64, limit int) ([]*Message, bool, error)
+	// Scan 遍历所有保存的消息，用于启动时重建搜索索引
+	Scan(fn func(msg *Message))
+}
+
+// NewHistoryStore 按配置创建历史消息存储
+func NewHistoryStore(cfg config.HistoryConfig) (HistoryStore, error) {
+	switch cfg.Backend {
+	case "", HistoryBackendMemory:
+		return NewMemoryHistoryStore(cfg.Capacity), nil
+	case HistoryBackendDisk:
+		return NewDiskHistoryStore(cfg.Dir, cfg.MaxOpenFiles)
+	default:
+		return nil, fmt.Errorf("unknown history backend %q", cfg.Backend)
+	}
+}
+
+// historyRing 单个会话的环形缓冲，写满后覆盖最早的消息
+type historyRing struct {
+	messages []*Message
+	start    int // 最早消息的下标
+	size     int
+}
+
+// MemoryHistoryStore 基于内存的历史消息存储，每个会话只保留最近 capacity 条
+type MemoryHistoryStore struct {
+	rings    map[string]*historyRing
+	messages map[uint64]*Message // 消息ID -> 消息，随环形缓冲的淘汰同步删除
+	capacity int
+	mutex    sync.RWMutex
+}
+
+// NewMemoryHistoryStore 创建基于内存的历史消息存储
+func NewMemoryHistoryStore(capacity int) *MemoryHistoryStore {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &MemoryHistoryStore{
+		rings:    make(map[string]*historyRing),
+		messages: make(map[uint64]*Message),
+		capacity: capacity,
+	}
+}
+
+// Append 记录会话中的一条消息，会话写满时淘汰最早的消息
+func (s *MemoryHistoryStore) Append(msg *Message) (*Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ring, exists := s.rings[msg.ConversationID]
+	if !exists {
+		ring = &historyRing{messages: make([]*Message, s.capacity)}
+		s.rings[msg.ConversationID] = ring
+	}
+
+	if _, exists := s.messages[msg.ID]; exists {
+		for i := 0; i < ring.size; i++ {
+			j := (ring.start + i) % len(ring.messages)
+			if ring.messages[j].ID == msg.ID {
+				ring.messages[j] = msg
+				break
+			}
+		}
+		s.messages[msg.ID] = msg
+		return nil, nil
+	}
+	s.messages[msg.ID] = msg
+
+	if ring.size < len(ring.messages) {
+		ring.messages[(ring.start+ring.size)%len(ring.messages)] = msg
+		ring.size++
+		return nil, nil
+	}
+	evicted := ring.messages[ring.start]
+	delete(s.messages, evicted.ID)
+	ring.messages[ring.start] = msg
+	ring.start = (ring.start + 1) % len(ring.messages)
+	return evicted, nil
+}
+
+// Get 按消息ID获取消息
+func (s *MemoryHistoryStore) Get(id uint64) (*Message, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	msg, exists := s.messages[id]
+	return msg, exists, nil
+}
+
+// Before 按消息ID向前分页
+func (s *MemoryHistoryStore) Before(conversationID string, before uint64, limit int) ([]*Message, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ring, exists := s.rings[conversationID]
+	if !exists {
+		return []*Message{}, false, nil
+	}
+
+	// 写入顺序与ID顺序只在并发发送时略有差异，取出后按ID排序
+	candidates := make([]*Message, 0, ring.size)
+	for i := 0; i < ring.size; i++ {
+		msg := ring.messages[(ring.start+i)%len(ring.messages)]
+		if before == 0 || msg.ID < before {
+			candidates = append(candidates, msg)
+		}
+	}
+	sortMessagesByID(candidates)
+
+	if len(candidates) <= limit {
+		return candidates, false, nil
+	}
+	return candidates[len(candidates)-limit:], true, nil
+}
+
+// Scan 遍历所有保存的消息
+func (s *MemoryHistoryStore) Scan(fn func(msg *Message)) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, msg := range s.messages {
+		fn(msg)
+	}
+}
@@ -0,0 +1,427 @@
+package model
+
+import (
+	"bufio"
+	"cmp"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	historyFileSuffix       = ".jsonl"
+	historyCompactSuffix    = ".tmp"  // 压缩过程中的临时文件，压缩完成后替换原文件
+	historyCompactMinBytes  = 1 << 20 // 被覆盖的旧版本至少达到该大小、且不少于文件的一半时压缩
+	historyDefaultOpenFiles = 256     // 未配置时同时打开的会话文件数上限
+)
+
+// historyIndexEntry 消息在会话文件中的位置
+type historyIndexEntry struct {
+	id     uint64
+	offset int64
+	length int
+}
+
+// historyFile 单个会话的历史文件及其按消息ID升序的索引
+// 文件句柄按需打开，由 DiskHistoryStore 的 LRU 限制同时打开的数量。
+type historyFile struct {
+	path  string
+	file  *os.File      // 未打开时为 nil
+	elem  *list.Element // 在 LRU 中的位置，未打开时为 nil
+	size  int64
+	dead  int64 // 被新版本覆盖或无法解析的记录字节数，压缩时回收
+	index []historyIndexEntry
+}
+
+// DiskHistoryStore 基于本地文件的历史消息存储
+// 每个会话一个追加写入的 JSON Lines 文件（文件名为会话标识的 sha256 十六进制摘要），内存中只保留消息ID到文件位置的索引。
+// 同一ID再次写入时追加新版本并更新索引，旧版本累计过多时重写文件只保留最新版本；
+// 启动时按顺序扫描文件重建索引，后写入的版本生效，会话标识取自文件中的消息。
+type DiskHistoryStore struct {
+	dir           string
+	maxOpenFiles  int
+	files         map[string]*historyFile // 会话标识 -> 历史文件
+	conversations map[uint64]string       // 消息ID -> 会话标识
+	open          *list.List              // 已打开的历史文件，最近使用的在前
+	mutex         sync.Mutex
+}
+
+// NewDiskHistoryStore 打开历史消息目录并重建索引，maxOpenFiles 为同时打开的文件数上限
+func NewDiskHistoryStore(dir string, maxOpenFiles int) (*DiskHistoryStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create history dir: %w", err)
+	}
+	if maxOpenFiles <= 0 {
+		maxOpenFiles = historyDefaultOpenFiles
+	}
+
+	s := &DiskHistoryStore{
+		dir:           dir,
+		maxOpenFiles:  maxOpenFiles,
+		files:         make(map[string]*historyFile),
+		conversations: make(map[uint64]string),
+		open:          list.New(),
+	}
+	if err := s.load(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close 关闭所有打开的历史文件
+func (s *DiskHistoryStore) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.open.Len() > 0 {
+		s.release(s.open.Back().Value.(*historyFile))
+	}
+}
+
+// Append 追加一条消息，磁盘后端不淘汰消息
+func (s *DiskHistoryStore) Append(msg *Message) (*Message, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hf, exists := s.files[msg.ConversationID]
+	if !exists {
+		hf = &historyFile{path: filepath.Join(s.dir, historyFileName(msg.ConversationID))}
+	}
+	file, err := s.handle(hf)
+	if err != nil {
+		return nil, err
+	}
+	s.files[msg.ConversationID] = hf
+
+	offset := hf.size
+	if _, err := file.Write(data); err != nil {
+		// 回滚写了一半的记录，保证下一条记录从完整的行开始
+		file.Truncate(hf.size)
+		return nil, fmt.Errorf("write history: %w", err)
+	}
+	hf.size += int64(len(data))
+	hf.dead += int64(hf.put(historyIndexEntry{id: msg.ID, offset: offset, length: len(data)}))
+	s.conversations[msg.ID] = msg.ConversationID
+
+	if hf.needsCompaction() {
+		if err := s.compact(hf); err != nil {
+			// 压缩失败不影响已写入的消息，下次写入时重试
+			logger.Warn("压缩历史文件失败", zap.Error(err), zap.String("file", hf.path))
+		}
+	}
+	return nil, nil
+}
+
+// Get 按消息ID获取消息
+func (s *DiskHistoryStore) Get(id uint64) (*Message, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conversationID, exists := s.conversations[id]
+	if !exists {
+		return nil, false, nil
+	}
+	hf := s.files[conversationID]
+	i, found := slices.BinarySearchFunc(hf.index, id, func(entry historyIndexEntry, id uint64) int {
+		return cmp.Compare(entry.id, id)
+	})
+	if !found {
+		return nil, false, nil
+	}
+	msg, err := s.read(hf, hf.index[i])
+	if err != nil {
+		return nil, false, err
+	}
+	return msg, true, nil
+}
+
+// Before 按消息ID向前分页
+func (s *DiskHistoryStore) Before(conversationID string, before uint64, limit int) ([]*Message, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hf, exists := s.files[conversationID]
+	if !exists {
+		return []*Message{}, false, nil
+	}
+
+	end := len(hf.index)
+	if before > 0 {
+		end = sort.Search(len(hf.index), func(i int) bool {
+			return hf.index[i].id >= before
+		})
+	}
+	start := max(end-limit, 0)
+
+	messages := make([]*Message, 0, end-start)
+	for _, entry := range hf.index[start:end] {
+		msg, err := s.read(hf, entry)
+		if err != nil {
+			return nil, false, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, start > 0, nil
+}
+
+// Scan 遍历所有保存的消息，无法读取的记录记录日志后跳过
+func (s *DiskHistoryStore) Scan(fn func(msg *Message)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, hf := range s.files {
+		for _, entry := range hf.index {
+			msg, err := s.read(hf, entry)
+			if err != nil {
+				logger.Warn("跳过无法读取的历史记录", zap.Error(err), zap.String("file", hf.path), zap.Int64("offset", entry.offset))
+				continue
+			}
+			fn(msg)
+		}
+	}
+}
+
+// read 读取索引指向的消息
+func (s *DiskHistoryStore) read(hf *historyFile, entry historyIndexEntry) (*Message, error) {
+	file, err := s.handle(hf)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, entry.length)
+	if _, err := file.ReadAt(data, entry.offset); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("decode history: %w", err)
+	}
+	return &msg, nil
+}
+
+// put 写入索引，保持按消息ID升序；已存在的ID更新为新版本的位置，返回被覆盖的旧版本长度
+func (hf *historyFile) put(entry historyIndexEntry) int {
+	i := sort.Search(len(hf.index), func(i int) bool {
+		return hf.index[i].id >= entry.id
+	})
+	if i < len(hf.index) && hf.index[i].id == entry.id {
+		replaced := hf.index[i].length
+		hf.index[i] = entry
+		return replaced
+	}
+	hf.index = append(hf.index, historyIndexEntry{})
+	copy(hf.index[i+1:], hf.index[i:])
+	hf.index[i] = entry
+	return 0
+}
+
+// needsCompaction 被覆盖的旧版本是否多到需要重写文件
+func (hf *historyFile) needsCompaction() bool {
+	return hf.dead >= historyCompactMinBytes && hf.dead*2 >= hf.size
+}
+
+// compact 将每条消息的最新版本按ID顺序写入临时文件，再原子替换原文件
+func (s *DiskHistoryStore) compact(hf *historyFile) error {
+	file, err := s.handle(hf)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := hf.path + historyCompactSuffix
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create compacted history: %w", err)
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	index := make([]historyIndexEntry, 0, len(hf.index))
+	var offset int64
+	for _, entry := range hf.index {
+		data := make([]byte, entry.length)
+		if _, err := file.ReadAt(data, entry.offset); err != nil {
+			return fail(fmt.Errorf("read history: %w", err))
+		}
+		if _, err := writer.Write(data); err != nil {
+			return fail(fmt.Errorf("write compacted history: %w", err))
+		}
+		index = append(index, historyIndexEntry{id: entry.id, offset: offset, length: entry.length})
+		offset += int64(entry.length)
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(fmt.Errorf("write compacted history: %w", err))
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(fmt.Errorf("sync compacted history: %w", err))
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("close compacted history: %w", err)
+	}
+	if err := os.Rename(tmpPath, hf.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("replace history: %w", err)
+	}
+
+	logger.Info("历史文件压缩完成", zap.String("file", hf.path), zap.Int64("before", hf.size), zap.Int64("after", offset))
+	// 旧句柄指向已被替换的文件，下次访问时重新打开
+	s.release(hf)
+	hf.size = offset
+	hf.dead = 0
+	hf.index = index
+	return nil
+}
+
+// load 扫描目录中的会话文件重建索引
+func (s *DiskHistoryStore) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read history dir: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, historyFileSuffix+historyCompactSuffix) {
+			// 压缩中途退出留下的临时文件，原文件仍然完整
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, historyFileSuffix) {
+			continue
+		}
+
+		hf := &historyFile{path: filepath.Join(s.dir, name)}
+		conversationID, err := s.scan(hf)
+		if err != nil {
+			return err
+		}
+		if conversationID == "" {
+			// 没有可用记录的文件不属于任何会话
+			s.release(hf)
+			continue
+		}
+		s.files[conversationID] = hf
+		for _, entry := range hf.index {
+			s.conversations[entry.id] = conversationID
+		}
+		if hf.needsCompaction() {
+			if err := s.compact(hf); err != nil {
+				logger.Warn("压缩历史文件失败", zap.Error(err), zap.String("file", hf.path))
+			}
+		}
+	}
+	logger.Info("历史消息索引重建完成", zap.String("dir", s.dir), zap.Int("conversations", len(s.files)))
+	return nil
+}
+
+// scan 逐行读取会话文件重建索引，末尾不完整的记录被截断；返回文件所属的会话标识
+func (s *DiskHistoryStore) scan(hf *historyFile) (string, error) {
+	file, err := s.handle(hf)
+	if err != nil {
+		return "", err
+	}
+
+	var conversationID string
+	reader := bufio.NewReader(io.NewSectionReader(file, 0, hf.size))
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				logger.Warn("截断历史文件末尾不完整的记录", zap.String("file", hf.path), zap.Int64("offset", offset))
+				if err := file.Truncate(offset); err != nil {
+					return "", fmt.Errorf("truncate history: %w", err)
+				}
+				hf.size = offset
+			}
+			return conversationID, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("read history: %w", err)
+		}
+
+		var msg struct {
+			ID             uint64 `json:"id"`
+			ConversationID string `json:"conversation-id"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			logger.Warn("跳过无法解析的历史记录", zap.Error(err), zap.String("file", hf.path), zap.Int64("offset", offset))
+			hf.dead += int64(len(line))
+		} else {
+			hf.dead += int64(hf.put(historyIndexEntry{id: msg.ID, offset: offset, length: len(line)}))
+			if conversationID == "" {
+				conversationID = msg.ConversationID
+			}
+		}
+		offset += int64(len(line))
+	}
+}
+
+// handle 返回会话文件的句柄，未打开时打开（不存在时创建），超过打开数上限时关闭最久未使用的文件
+func (s *DiskHistoryStore) handle(hf *historyFile) (*os.File, error) {
+	if hf.file != nil {
+		s.open.MoveToFront(hf.elem)
+		return hf.file, nil
+	}
+
+	file, err := os.OpenFile(hf.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stat history: %w", err)
+	}
+
+	hf.file = file
+	hf.size = info.Size()
+	hf.elem = s.open.PushFront(hf)
+	for s.open.Len() > s.maxOpenFiles {
+		s.release(s.open.Back().Value.(*historyFile))
+	}
+	return file, nil
+}
+
+// release 关闭会话文件的句柄并移出 LRU
+func (s *DiskHistoryStore) release(hf *historyFile) {
+	if hf.file == nil {
+		return
+	}
+	hf.file.Close()
+	s.open.Remove(hf.elem)
+	hf.file = nil
+	hf.elem = nil
+}
+
+// historyFileName 会话文件名：会话标识的 sha256 十六进制摘要，长度固定且不含路径分隔符
+func historyFileName(conversationID string) string {
+	sum := sha256.Sum256([]byte(conversationID))
+	return hex.EncodeToString(sum[:]) + historyFileSuffix
+}
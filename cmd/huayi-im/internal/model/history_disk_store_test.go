@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestHistoryStore(t *testing.T, dir string, maxOpenFiles int) *DiskHistoryStore {
+	t.Helper()
+	s, err := NewDiskHistoryStore(dir, maxOpenFiles)
+	if err != nil {
+		t.Fatalf("NewDiskHistoryStore: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func appendTestHistory(t *testing.T, s HistoryStore, conversationID string, id uint64, content string) {
+	t.Helper()
+	msg := &Message{ID: id, ConversationID: conversationID, Seq: id, From: "alice", Content: content, CreatedAt: time.Now()}
+	if _, err := s.Append(msg); err != nil {
+		t.Fatalf("Append(%s, %d): %v", conversationID, id, err)
+	}
+}
+
+func TestDiskHistoryStoreBoundsOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestHistoryStore(t, dir, 2)
+	for i := 0; i < 5; i++ {
+		appendTestHistory(t, s, fmt.Sprintf("topic:t%d", i), uint64(i+1), "hello")
+	}
+	if got := s.open.Len(); got != 2 {
+		t.Fatalf("open files = %d, want 2", got)
+	}
+
+	// 已关闭的文件在访问时重新打开
+	msgs, _, err := s.Before("topic:t0", 0, 10)
+	if err != nil || len(msgs) != 1 || msgs[0].ID != 1 {
+		t.Fatalf("Before(topic:t0) = %v, %v, want message 1", msgs, err)
+	}
+	if got := s.open.Len(); got != 2 {
+		t.Fatalf("open files after reopen = %d, want 2", got)
+	}
+}
+
+func TestDiskHistoryStoreReloadAfterCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestHistoryStore(t, dir, 0)
+	appendTestHistory(t, s, "p2p:alice,bob", 1, "first")
+	// 反复改写同一消息，旧版本超过压缩阈值后重写文件
+	content := strings.Repeat("x", 64<<10)
+	for i := 0; i < 40; i++ {
+		appendTestHistory(t, s, "p2p:alice,bob", 2, fmt.Sprintf("%s %d", content, i))
+	}
+	// 共写入约 2.5MB，压缩后文件中只剩不足阈值的旧版本
+	hf := s.files["p2p:alice,bob"]
+	info, err := os.Stat(hf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != hf.size || hf.dead >= historyCompactMinBytes {
+		t.Fatalf("file size = %d (tracked %d, dead %d), want compacted file", info.Size(), hf.size, hf.dead)
+	}
+
+	// 重启后每条消息恢复为最后写入的版本
+	s.Close()
+	s = openTestHistoryStore(t, dir, 0)
+	msgs, hasMore, err := s.Before("p2p:alice,bob", 0, 10)
+	if err != nil || hasMore || len(msgs) != 2 {
+		t.Fatalf("Before after reload = %d messages, %v, %v, want 2", len(msgs), hasMore, err)
+	}
+	if msgs[0].Content != "first" || !strings.HasSuffix(msgs[1].Content, " 39") {
+		t.Fatalf("contents after reload are not the latest versions (message 2 has %d bytes)", len(msgs[1].Content))
+	}
+}
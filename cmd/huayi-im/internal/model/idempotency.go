@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxClientMsgIDLen client-msg-id 的最大字节数
+const maxClientMsgIDLen = 128
+
+var (
+	// ErrInvalidClientMsgID client-msg-id 过长
+	ErrInvalidClientMsgID = errors.New("client-msg-id is too long")
+)
+
+// sendRecord 发送者的一次带 client-msg-id 的发送
+type sendRecord struct {
+	done      chan struct{} // 首次发送结束后关闭
+	messages  []*Message    // 首次发送成功的消息，失败时为 nil
+	expiresAt time.Time     // 首次发送结束前为零值
+}
+
+// idempotencyCache 按发送者记住 client-msg-id 对应的首次发送结果
+// 窗口内的重试直接返回首次发送的消息，不再分配ID与扇出；首次发送失败时记录被移除，允许重试。
+type idempotencyCache struct {
+	window  time.Duration
+	records map[string]*sendRecord // sender + "\x00" + client-msg-id -> 发送记录
+	mutex   sync.Mutex
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		window:  window,
+		records: make(map[string]*sendRecord),
+	}
+}
+
+func idempotencyKey(sender, clientMsgID string) string {
+	return sender + "\x00" + clientMsgID
+}
+
+// claim 登记一次发送，返回发送记录以及是否为首次发送
+// 非首次发送时调用方应等待记录的 done，过期的记录视为不存在。
+func (ic *idempotencyCache) claim(sender, clientMsgID string, now time.Time) (*sendRecord, bool) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	key := idempotencyKey(sender, clientMsgID)
+	if record, exists := ic.records[key]; exists && (record.expiresAt.IsZero() || now.Before(record.expiresAt)) {
+		return record, false
+	}
+	record := &sendRecord{done: make(chan struct{})}
+	ic.records[key] = record
+	return record, true
+}
+
+// complete 记录首次发送的结果并唤醒等待的重试，messages 为 nil 表示发送失败
+func (ic *idempotencyCache) complete(sender, clientMsgID string, record *sendRecord, messages []*Message) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	record.messages = messages
+	record.expiresAt = time.Now().Add(ic.window)
+	if messages == nil {
+		key := idempotencyKey(sender, clientMsgID)
+		if ic.records[key] == record {
+			delete(ic.records, key)
+		}
+	}
+	close(record.done)
+}
+
+// expire 清理过期的发送记录，返回清理的条数
+func (ic *idempotencyCache) expire(now time.Time) int {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	removed := 0
+	for key, record := range ic.records {
+		if !record.expiresAt.IsZero() && !now.Before(record.expiresAt) {
+			delete(ic.records, key)
+			removed++
+		}
+	}
+	return removed
+}
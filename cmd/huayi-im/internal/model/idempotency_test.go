@@ -0,0 +1,108 @@
+package model
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyClaimComplete(t *testing.T) {
+	ic := newIdempotencyCache(time.Minute)
+	now := time.Now()
+
+	record, first := ic.claim("alice", "c1", now)
+	if !first {
+		t.Fatal("first claim not reported as first")
+	}
+	// 不同发送者的相同 client-msg-id 互不影响
+	if _, first := ic.claim("bob", "c1", now); !first {
+		t.Fatal("claim by another sender not reported as first")
+	}
+
+	sent := []*Message{{ID: 1}}
+	ic.complete("alice", "c1", record, sent)
+	retry, first := ic.claim("alice", "c1", now)
+	if first || retry != record {
+		t.Fatal("retry within window not deduplicated")
+	}
+	<-retry.done
+	if len(retry.messages) != 1 || retry.messages[0].ID != 1 {
+		t.Fatalf("retry messages = %v, want first send", retry.messages)
+	}
+}
+
+func TestIdempotencyConcurrentRetries(t *testing.T) {
+	ic := newIdempotencyCache(time.Minute)
+	record, _ := ic.claim("alice", "c1", time.Now())
+
+	// 首次发送结束前到达的重试等待其结果
+	const retries = 8
+	var wg sync.WaitGroup
+	results := make(chan []*Message, retries)
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retry, first := ic.claim("alice", "c1", time.Now())
+			if first {
+				results <- nil
+				return
+			}
+			<-retry.done
+			results <- retry.messages
+		}()
+	}
+
+	ic.complete("alice", "c1", record, []*Message{{ID: 7}})
+	wg.Wait()
+	close(results)
+	for messages := range results {
+		if len(messages) != 1 || messages[0].ID != 7 {
+			t.Fatalf("retry got %v, want the first send", messages)
+		}
+	}
+}
+
+func TestIdempotencyFailureAllowsRetry(t *testing.T) {
+	ic := newIdempotencyCache(time.Minute)
+	record, _ := ic.claim("alice", "c1", time.Now())
+	waiter, first := ic.claim("alice", "c1", time.Now())
+	if first {
+		t.Fatal("concurrent claim reported as first")
+	}
+
+	// 首次发送失败：等待者得到 nil，之后的重试重新发送
+	ic.complete("alice", "c1", record, nil)
+	<-waiter.done
+	if waiter.messages != nil {
+		t.Fatalf("waiter messages = %v, want nil after failure", waiter.messages)
+	}
+	if _, first := ic.claim("alice", "c1", time.Now()); !first {
+		t.Fatal("claim after failed send not reported as first")
+	}
+}
+
+func TestIdempotencyExpire(t *testing.T) {
+	ic := newIdempotencyCache(time.Minute)
+	done, _ := ic.claim("alice", "c1", time.Now())
+	ic.complete("alice", "c1", done, []*Message{{ID: 1}})
+	ic.claim("alice", "c2", time.Now())
+
+	later := time.Now().Add(2 * time.Minute)
+	// 窗口过后的重试视为新的发送
+	if _, first := ic.claim("alice", "c1", later); !first {
+		t.Fatal("claim after window not reported as first")
+	}
+
+	ic = newIdempotencyCache(time.Minute)
+	done, _ = ic.claim("alice", "c1", time.Now())
+	ic.complete("alice", "c1", done, []*Message{{ID: 1}})
+	ic.claim("alice", "c2", time.Now())
+	// 未结束的发送没有过期时间，不会被清理
+	if n := ic.expire(later); n != 1 {
+		t.Fatalf("expire = %d, want 1", n)
+	}
+	if _, exists := ic.records[idempotencyKey("alice", "c2")]; !exists {
+		t.Fatal("pending record expired")
+	}
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+// inflightEntry 已写出、等待客户端确认的下行消息
+type inflightEntry struct {
+	msg      *Message
+	attempts int       // 已发送次数
+	deadline time.Time // 超过该时间未确认则重传
+}
+
+// inflightWindow 连接上未确认消息的窗口，按消息ID索引
+type inflightWindow struct {
+	entries    map[uint64]*inflightEntry
+	size       int
+	timeout    time.Duration
+	maxBackoff time.Duration
+	maxRetries int
+	mutex      sync.Mutex
+}
+
+// newInflightWindow 创建未确认消息窗口
+func newInflightWindow(cfg config.AckConfig) *inflightWindow {
+	return &inflightWindow{
+		entries:    make(map[uint64]*inflightEntry),
+		size:       cfg.Window,
+		timeout:    cfg.Timeout,
+		maxBackoff: cfg.MaxBackoff,
+		maxRetries: cfg.MaxRetries,
+	}
+}
+
+// track 消息写出前登记；重传时累加发送次数并按指数退避推迟下次重传
+func (w *inflightWindow) track(msg *Message) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	entry, exists := w.entries[msg.ID]
+	if !exists {
+		entry = &inflightEntry{msg: msg}
+		w.entries[msg.ID] = entry
+	}
+	entry.attempts++
+
+	backoff := w.timeout << (entry.attempts - 1)
+	if backoff <= 0 || backoff > w.maxBackoff {
+		backoff = w.maxBackoff
+	}
+	entry.deadline = time.Now().Add(backoff)
+}
+
+// ack 确认消息，返回被确认的消息，不在窗口中时返回 nil
+func (w *inflightWindow) ack(id uint64) *Message {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	entry, exists := w.entries[id]
+	if !exists {
+		return nil
+	}
+	delete(w.entries, id)
+	return entry.msg
+}
+
+// remove 将消息移出窗口（被驱逐或转存离线时）
+func (w *inflightWindow) remove(id uint64) {
+	w.mutex.Lock()
+	delete(w.entries, id)
+	w.mutex.Unlock()
+}
+
+// take 将消息移出窗口，返回消息此前是否在窗口中
+// 与 takeAll、oldest 等并发时只有一方能取到同一条消息，取到的一方负责转存。
+func (w *inflightWindow) take(id uint64) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, exists := w.entries[id]
+	delete(w.entries, id)
+	return exists
+}
+
+// contains 消息是否在窗口中
+func (w *inflightWindow) contains(id uint64) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, exists := w.entries[id]
+	return exists
+}
+
+// full 窗口是否已满
+func (w *inflightWindow) full() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.size > 0 && len(w.entries) >= w.size
+}
+
+// oldest 取出并移除窗口中ID最小（最早）的消息
+func (w *inflightWindow) oldest() *Message {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var oldest *inflightEntry
+	for _, entry := range w.entries {
+		if oldest == nil || entry.msg.ID < oldest.msg.ID {
+			oldest = entry
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+	delete(w.entries, oldest.msg.ID)
+	return oldest.msg
+}
+
+// due 返回已到重传时间的消息；发送次数已达上限的消息计入 exhausted
+func (w *inflightWindow) due(now time.Time) (retry []*Message, exhausted bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, entry := range w.entries {
+		if now.Before(entry.deadline) {
+			continue
+		}
+		if entry.attempts >= w.maxRetries {
+			exhausted = true
+			continue
+		}
+		retry = append(retry, entry.msg)
+	}
+	sortMessagesByID(retry)
+	return retry, exhausted
+}
+
+// takeAll 取出并清空窗口中的全部消息，按ID排序
+func (w *inflightWindow) takeAll() []*Message {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	messages := make([]*Message, 0, len(w.entries))
+	for _, entry := range w.entries {
+		messages = append(messages, entry.msg)
+	}
+	w.entries = make(map[uint64]*inflightEntry)
+	sortMessagesByID(messages)
+	return messages
+}
+
+// sortMessagesByID 按消息ID（即发送时间）升序排序
+func sortMessagesByID(messages []*Message) {
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+func TestInflightBackoff(t *testing.T) {
+	w := newInflightWindow(config.AckConfig{Timeout: time.Second, MaxBackoff: 3 * time.Second, MaxRetries: 5})
+	msg := &Message{ID: 1}
+
+	// 每次重传退避时间翻倍，不超过 MaxBackoff
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		before := time.Now()
+		w.track(msg)
+		if got := w.entries[1].deadline.Sub(before); got < want || got > want+100*time.Millisecond {
+			t.Fatalf("attempt %d backoff = %v, want %v", w.entries[1].attempts, got, want)
+		}
+	}
+}
+
+func TestInflightDue(t *testing.T) {
+	w := newInflightWindow(config.AckConfig{Timeout: time.Second, MaxBackoff: time.Minute, MaxRetries: 2})
+	w.track(&Message{ID: 2})
+	w.track(&Message{ID: 1})
+
+	if retry, exhausted := w.due(time.Now()); len(retry) != 0 || exhausted {
+		t.Fatalf("due before deadline = %v, %v, want none", retry, exhausted)
+	}
+	retry, exhausted := w.due(time.Now().Add(2 * time.Second))
+	if exhausted || len(retry) != 2 || retry[0].ID != 1 || retry[1].ID != 2 {
+		t.Fatalf("due after deadline = %v, %v, want [1 2] in order", retry, exhausted)
+	}
+
+	// 发送次数达到上限后不再重传，报告 exhausted
+	w.track(&Message{ID: 1})
+	retry, exhausted = w.due(time.Now().Add(time.Hour))
+	if !exhausted || len(retry) != 1 || retry[0].ID != 2 {
+		t.Fatalf("due after retries = %v, %v, want [2] and exhausted", retry, exhausted)
+	}
+}
+
+func TestInflightAckAndTake(t *testing.T) {
+	w := newInflightWindow(config.AckConfig{Window: 2, Timeout: time.Second, MaxBackoff: time.Minute, MaxRetries: 3})
+	w.track(&Message{ID: 3})
+	w.track(&Message{ID: 1})
+	if !w.full() {
+		t.Fatal("window with 2 entries not full")
+	}
+
+	if msg := w.ack(1); msg == nil || msg.ID != 1 {
+		t.Fatalf("ack(1) = %v, want message 1", msg)
+	}
+	if msg := w.ack(1); msg != nil {
+		t.Fatalf("second ack(1) = %v, want nil", msg)
+	}
+	// 并发取走同一条消息时只有一方成功
+	if !w.take(3) || w.take(3) {
+		t.Fatal("take(3) should succeed exactly once")
+	}
+
+	w.track(&Message{ID: 5})
+	w.track(&Message{ID: 4})
+	if msg := w.oldest(); msg == nil || msg.ID != 4 {
+		t.Fatalf("oldest = %v, want message 4", msg)
+	}
+	if got := w.takeAll(); len(got) != 1 || got[0].ID != 5 || len(w.entries) != 0 {
+		t.Fatalf("takeAll = %v, want [5] and an empty window", got)
+	}
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"os"
+	"testing"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	// 模型层直接使用全局 logger，测试中只输出错误日志
+	logger.Init(config.LogConfig{Level: "error"})
+	os.Exit(m.Run())
+}
@@ -1,19 +1,80 @@
 package model
 
 import (
+	"sort"
+	"strings"
 	"time"
 )
 
 // Message 消息模型
 type Message struct {
-	ID          uint64    `json:"id"`
-	From        string    `json:"from"`
-	To          []string  `json:"to,omitempty"`
-	Topic       string    `json:"topic,omitempty"`
-	ContentType string    `json:"content-type"`
-	Content     string    `json:"content"`
-	MessageType string    `json:"message-type"`
-	CreatedAt   time.Time `json:"created-at"`
+	ID             uint64          `json:"id"`                        // 服务端分配的全局唯一ID，随时间递增
+	ConversationID string          `json:"conversation-id,omitempty"` // 所属会话，见 ConversationKey
+	Seq            uint64          `json:"seq"`                       // 会话内单调递增的序号
+	From           string          `json:"from"`
+	To             []string        `json:"to,omitempty"`
+	Topic          string          `json:"topic,omitempty"`
+	ContentType    string          `json:"content-type"`
+	Content        string          `json:"content"`
+	MessageType    string          `json:"message-type"`
+	CreatedAt      time.Time       `json:"created-at"`
+	TTL            int64           `json:"ttl,omitempty"`           // 离线保留秒数，只能缩短服务端配置的保留时间，0 表示使用配置
+	Summary        *MessageSummary `json:"summary,omitempty"`       // message-type 为 summary 时，被折叠的离线消息范围
+	EditedAt       *time.Time      `json:"edited-at,omitempty"`     // 最后一次编辑的时间
+	RecalledAt     *time.Time      `json:"recalled-at,omitempty"`   // 撤回时间，撤回后内容被清空
+	Reactions      []Reaction      `json:"reactions,omitempty"`     // 按表情聚合的回应，按首次回应先后排列
+	ReplyTo        uint64          `json:"reply-to,omitempty"`      // 回复的消息ID，必须属于同一会话
+	ThreadRoot     uint64          `json:"thread-root,omitempty"`   // 回复所在话题串的根消息ID，由服务端根据 reply-to 填写
+	Thread         *ThreadSummary  `json:"thread,omitempty"`        // 作为话题串根消息时的回复统计
+	ClientMsgID    string          `json:"client-msg-id,omitempty"` // 客户端生成的消息ID，窗口内按发送者去重重试
+	Muted          bool            `json:"muted,omitempty"`         // 接收者屏蔽了所在 topic：照常投递与保存离线，客户端不提示通知
+}
+
+// withMuted 返回标记为 muted 的消息副本，已标记时原样返回
+func withMuted(msg *Message) *Message {
+	if msg.Muted {
+		return msg
+	}
+	muted := *msg
+	muted.Muted = true
+	return &muted
+}
+
+// MessageSummary 离线积压压缩后的摘要，客户端可按 first-id/last-id 按需拉取历史消息
+type MessageSummary struct {
+	Count   int       `json:"count"`
+	FirstID uint64    `json:"first-id"`
+	LastID  uint64    `json:"last-id"`
+	Since   time.Time `json:"since"`
+}
+
+// ConversationKey 计算消息所属会话的标识
+// 群聊为 "topic:<topic>"；单聊为 "p2p:" 加上按字典序排列的发送者与接收者。
+// 发给多个接收者的单聊消息在发送时按接收者拆分，每条消息只有一个接收者。
+func ConversationKey(msg *Message) string {
+	if msg.Topic != "" {
+		return TopicConversationKey(msg.Topic)
+	}
+	return P2PConversationKey(append([]string{msg.From}, msg.To...)...)
+}
+
+// TopicConversationKey 群聊会话标识
+func TopicConversationKey(topic string) string {
+	return "topic:" + topic
+}
+
+// P2PConversationKey 单聊会话标识
+func P2PConversationKey(participants ...string) string {
+	users := make([]string, 0, len(participants))
+	seen := make(map[string]bool, len(participants))
+	for _, user := range participants {
+		if !seen[user] {
+			seen[user] = true
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	return "p2p:" + strings.Join(users, ",")
 }
 
 // OfflineMessage 离线消息模型
@@ -21,4 +82,40 @@ type OfflineMessage struct {
 	UserID    string    `json:"user_id"`
 	Message   *Message  `json:"message"`
 	ExpiresAt time.Time `json:"expires_at"`
+	Size      int64     `json:"-"` // 序列化后的字节数，用于离线存储的容量限制
+}
+
+// MessageBatch 批量下行消息帧，离线回放时按消息ID顺序分批下发
+// 批内每条消息仍需客户端逐条确认。
+type MessageBatch struct {
+	MessageType string     `json:"message-type"` // 固定为 batch
+	Messages    []*Message `json:"messages"`
+}
+
+// NewMessageBatch 创建批量下行消息帧
+func NewMessageBatch(messages []*Message) *MessageBatch {
+	return &MessageBatch{
+		MessageType: "batch",
+		Messages:    messages,
+	}
+}
+
+// SystemMessage 系统下行消息（kicked 等事件通知），不保存离线
+type SystemMessage struct {
+	From        string      `json:"from"`
+	To          []string    `json:"to,omitempty"`
+	MessageType string      `json:"message-type"`
+	Data        interface{} `json:"data,omitempty"`
+	CreatedAt   time.Time   `json:"created-at"`
+}
+
+// NewSystemMessage 创建发给指定用户的系统消息
+func NewSystemMessage(messageType, to string, data interface{}) *SystemMessage {
+	return &SystemMessage{
+		From:        "server",
+		To:          []string{to},
+		MessageType: messageType,
+		Data:        data,
+		CreatedAt:   time.Now(),
+	}
 }
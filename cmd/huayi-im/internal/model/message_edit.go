@@ -0,0 +1,137 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotSender 只有消息发送者可以编辑或撤回消息
+	ErrNotSender = errors.New("only the sender can modify the message")
+	// ErrWindowExpired 已超出可编辑或撤回的时间窗口
+	ErrWindowExpired = errors.New("message can no longer be modified")
+	// ErrMessageRecalled 消息已被撤回
+	ErrMessageRecalled = errors.New("message has been recalled")
+)
+
+// MessageEdited 消息编辑事件，作为 message-edited 系统消息的 data 下发给会话参与者
+type MessageEdited struct {
+	ConversationID string    `json:"conversation-id"`
+	MessageID      uint64    `json:"message-id"`
+	ContentType    string    `json:"content-type"`
+	Content        string    `json:"content"`
+	EditedAt       time.Time `json:"edited-at"`
+}
+
+// MessageRecalled 消息撤回事件，作为 message-recalled 系统消息的 data 下发给会话参与者
+type MessageRecalled struct {
+	ConversationID string    `json:"conversation-id"`
+	MessageID      uint64    `json:"message-id"`
+	RecalledAt     time.Time `json:"recalled-at"`
+}
+
+// EditMessage 发送者在编辑窗口内修改消息内容，保留已有的表情回应
+// 历史记录与离线队列中的消息被替换为新版本，在线的会话参与者收到 message-edited 系统消息。
+func (mm *MessageManager) EditMessage(username string, messageID uint64, content string) (*Message, error) {
+	now := time.Now()
+	edited, err := mm.modifyMessage(username, messageID, mm.messageConfig.EditWindow, func(msg *Message) {
+		msg.Content = content
+		msg.EditedAt = &now
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mm.broadcastEvent(edited, "message-edited", MessageEdited{
+		ConversationID: edited.ConversationID,
+		MessageID:      edited.ID,
+		ContentType:    edited.ContentType,
+		Content:        edited.Content,
+		EditedAt:       now,
+	})
+	return withReacted(edited, username), nil
+}
+
+// RecallMessage 发送者在撤回窗口内撤回消息
+// 历史记录与离线队列中的消息被替换为清空内容与回应的墓碑，在线的会话参与者收到 message-recalled 系统消息。
+func (mm *MessageManager) RecallMessage(username string, messageID uint64) (*Message, error) {
+	now := time.Now()
+	recalled, err := mm.modifyMessage(username, messageID, mm.messageConfig.RecallWindow, func(msg *Message) {
+		msg.Content = ""
+		msg.RecalledAt = &now
+		msg.Reactions = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mm.broadcastEvent(recalled, "message-recalled", MessageRecalled{
+		ConversationID: recalled.ConversationID,
+		MessageID:      recalled.ID,
+		RecalledAt:     now,
+	})
+	return recalled, nil
+}
+
+// modifyMessage 校验权限与时间窗口后生成消息的新版本，替换历史记录、搜索索引与离线队列中的旧版本
+// 已发出的消息可能仍被发送队列、未确认窗口或离线回放引用，因此修改的是副本，并登记到 revisions，
+// 这些旧版本在写出或转存离线前替换为新版本；在会话锁内进行，与新消息的写入串行。
+func (mm *MessageManager) modifyMessage(username string, messageID uint64, window time.Duration, modify func(msg *Message)) (*Message, error) {
+	msg, exists, err := mm.history.Get(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+
+	conv := mm.conversation(msg.ConversationID)
+	conv.mutex.Lock()
+	defer conv.mutex.Unlock()
+
+	// 加锁后重新读取，避免与并发的编辑互相覆盖
+	msg, exists, err = mm.history.Get(messageID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !exists:
+		return nil, ErrMessageNotFound
+	case msg.From != username:
+		return nil, ErrNotSender
+	case msg.RecalledAt != nil:
+		return nil, ErrMessageRecalled
+	case window > 0 && time.Since(msg.CreatedAt) > window:
+		return nil, ErrWindowExpired
+	}
+
+	modified := *msg
+	modify(&modified)
+	if _, err := mm.history.Append(&modified); err != nil {
+		return nil, err
+	}
+	mm.search.Remove(msg.ID, msg.Content)
+	mm.search.Add(modified.ID, modified.ConversationID, modified.Content)
+	mm.revisions.put(&modified, time.Now())
+
+	if n := mm.offline.Rewrite(&modified); n > 0 {
+		logger.Info("已改写离线消息:", zap.Uint64("id", modified.ID), zap.Int("count", n))
+	}
+	return &modified, nil
+}
+
+// broadcastEvent 向会话参与者（含发送者的其他设备）的在线连接下发消息变更事件
+// 离线的参与者在离线队列中直接收到新版本，已取走旧版本的离线参与者可通过历史消息接口获取。
+func (mm *MessageManager) broadcastEvent(msg *Message, messageType string, data interface{}) {
+	participants, err := mm.participants(msg.ConversationID, msg.From)
+	if err != nil {
+		// 发送者已离开 topic 时仍通知其余成员
+		participants, _ = mm.topicManager.GetTopicUsers(msg.Topic)
+	}
+	for _, user := range participants {
+		mm.sendSystemMessage(user, NewSystemMessage(messageType, user, data))
+	}
+}
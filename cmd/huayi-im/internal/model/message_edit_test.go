@@ -0,0 +1,98 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+// sendTestMessage 由 from 向 to 发送一条单聊消息
+func sendTestMessage(t *testing.T, mm *MessageManager, from, to, content string) *Message {
+	t.Helper()
+	sent, err := mm.SendMessage(&Message{From: from, To: []string{to}, Content: content})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	return sent[0]
+}
+
+func TestEditMessage(t *testing.T) {
+	offline := NewMemoryOfflineStore(config.OfflineConfig{})
+	mm := newTestMessageManager(t, offline, NewMemoryHistoryStore(10))
+	msg := sendTestMessage(t, mm, "alice", "bob", "deploy failed")
+
+	if _, err := mm.EditMessage("bob", msg.ID, "hacked"); !errors.Is(err, ErrNotSender) {
+		t.Fatalf("EditMessage by recipient = %v, want ErrNotSender", err)
+	}
+	if _, err := mm.EditMessage("alice", 42, "x"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("EditMessage(unknown) = %v, want ErrMessageNotFound", err)
+	}
+
+	edited, err := mm.EditMessage("alice", msg.ID, "deploy succeeded")
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if edited.Content != "deploy succeeded" || edited.EditedAt == nil || edited.ID != msg.ID {
+		t.Fatalf("edited = %+v, want new content with edited-at", edited)
+	}
+	// 已发出的消息不被原地修改
+	if msg.Content != "deploy failed" {
+		t.Fatalf("original message changed to %q", msg.Content)
+	}
+
+	// 历史、离线队列与搜索索引都替换为新版本
+	if stored, _, _ := mm.history.Get(msg.ID); stored.Content != "deploy succeeded" {
+		t.Fatalf("history content = %q, want edited", stored.Content)
+	}
+	if leased := offline.Lease("bob", time.Now()); len(leased) != 1 || leased[0].Message.Content != "deploy succeeded" {
+		t.Fatalf("offline messages = %v, want the edited version", leased)
+	}
+	if hits, _, _ := mm.SearchMessages("bob", SearchQuery{Query: "failed", Limit: 10}); len(hits) != 0 {
+		t.Fatalf("search for old content = %d hits, want none", len(hits))
+	}
+	if hits, _, _ := mm.SearchMessages("bob", SearchQuery{Query: "succeeded", Limit: 10}); len(hits) != 1 {
+		t.Fatalf("search for new content = %d hits, want 1", len(hits))
+	}
+}
+
+func TestRecallMessage(t *testing.T) {
+	offline := NewMemoryOfflineStore(config.OfflineConfig{})
+	mm := newTestMessageManager(t, offline, NewMemoryHistoryStore(10))
+	msg := sendTestMessage(t, mm, "alice", "bob", "oops")
+
+	recalled, err := mm.RecallMessage("alice", msg.ID)
+	if err != nil {
+		t.Fatalf("RecallMessage: %v", err)
+	}
+	if recalled.Content != "" || recalled.RecalledAt == nil {
+		t.Fatalf("recalled = %+v, want an empty tombstone", recalled)
+	}
+	if leased := offline.Lease("bob", time.Now()); len(leased) != 1 || leased[0].Message.RecalledAt == nil {
+		t.Fatalf("offline messages = %v, want the tombstone", leased)
+	}
+
+	// 撤回后不能再编辑或撤回
+	if _, err := mm.EditMessage("alice", msg.ID, "again"); !errors.Is(err, ErrMessageRecalled) {
+		t.Fatalf("EditMessage after recall = %v, want ErrMessageRecalled", err)
+	}
+	if _, err := mm.RecallMessage("alice", msg.ID); !errors.Is(err, ErrMessageRecalled) {
+		t.Fatalf("RecallMessage after recall = %v, want ErrMessageRecalled", err)
+	}
+}
+
+func TestModifyMessageWindow(t *testing.T) {
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), NewMemoryHistoryStore(10))
+	mm.messageConfig.EditWindow = time.Millisecond
+	msg := sendTestMessage(t, mm, "alice", "bob", "hi")
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := mm.EditMessage("alice", msg.ID, "hello"); !errors.Is(err, ErrWindowExpired) {
+		t.Fatalf("EditMessage after window = %v, want ErrWindowExpired", err)
+	}
+	// 撤回窗口为 0 表示不限制
+	if _, err := mm.RecallMessage("alice", msg.ID); err != nil {
+		t.Fatalf("RecallMessage without window = %v, want nil", err)
+	}
+}
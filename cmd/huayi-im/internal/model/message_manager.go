@@ -1,95 +1,519 @@
 package model
 
 import (
+	"errors"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/idgen"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/search"
 	"go.uber.org/zap"
 )
 
 // MessageManager 消息管理器
 type MessageManager struct {
-	connections     map[string]*websocket.Conn
-	offlineMessages map[string][]*OfflineMessage
-	topicManager    *TopicManager
-	mutex           sync.RWMutex
-	connMutex       sync.RWMutex
+	connections   map[string]map[string]*Connection // username -> session ID -> 连接
+	offline       OfflineStore
+	history       HistoryStore
+	search        *search.Index
+	threads       *threadIndex
+	idempotency   *idempotencyCache
+	revisions     *revisionCache
+	conversations map[string]*conversation
+	topicManager  *TopicManager
+	dispatcher    *Dispatcher
+	receipts      *receiptTracker
+	typing        *typingTracker
+	presence      *presenceSubscriptions
+	leases        *offlineLeases
+	evictions     evictionCounter
+	wsConfig      config.WSConfig
+	offlineConfig config.OfflineConfig
+	messageConfig config.MessageConfig
+	connMutex     sync.RWMutex
+	convMutex     sync.Mutex
+}
+
+// conversation 会话状态：分配序号并保证同一会话的消息按序号顺序投递
+type conversation struct {
+	mutex   sync.Mutex
+	lastSeq uint64
+}
+
+// EvictionStats 慢消费者驱逐统计
+type EvictionStats struct {
+	DropOldest int64 `json:"drop-oldest"`
+	DropNewest int64 `json:"drop-newest"`
+	Disconnect int64 `json:"disconnect"`
+	Closed     int64 `json:"closed"`
+	Unacked    int64 `json:"unacked"`
+}
+
+// evictionCounter 并发安全的驱逐计数
+type evictionCounter struct {
+	dropOldest atomic.Int64
+	dropNewest atomic.Int64
+	disconnect atomic.Int64
+	closed     atomic.Int64
+	unacked    atomic.Int64
 }
 
 // NewMessageManager 创建消息管理器实例
-func NewMessageManager(topicManager *TopicManager) *MessageManager {
-	return &MessageManager{
-		connections:     make(map[string]*websocket.Conn),
-		offlineMessages: make(map[string][]*OfflineMessage),
-		topicManager:    topicManager,
+func NewMessageManager(topicManager *TopicManager, offline OfflineStore, history HistoryStore, cfg *config.Config) *MessageManager {
+	mm := &MessageManager{
+		connections:   make(map[string]map[string]*Connection),
+		offline:       offline,
+		history:       history,
+		search:        search.NewIndex(),
+		threads:       newThreadIndex(),
+		idempotency:   newIdempotencyCache(cfg.Message.IdempotencyWindow),
+		revisions:     newRevisionCache(cfg.Offline.TTL),
+		conversations: make(map[string]*conversation),
+		topicManager:  topicManager,
+		receipts:      newReceiptTracker(cfg.Receipt.RecentLimit),
+		presence:      newPresenceSubscriptions(),
+		leases:        newOfflineLeases(),
+		wsConfig:      cfg.WS,
+		offlineConfig: cfg.Offline,
+		messageConfig: cfg.Message,
 	}
+	mm.dispatcher = NewDispatcher(cfg.Dispatcher, mm.deliver, mm.deliverOffline)
+	mm.typing = newTypingTracker(cfg.Typing.TTL, cfg.Typing.MinInterval, mm.onTypingExpire)
+	// 持久化的历史消息在启动时重建搜索索引与话题串索引，并恢复各会话的序号，避免重启后重复使用已保存的序号
+	history.Scan(func(msg *Message) {
+		conv := mm.conversation(msg.ConversationID)
+		conv.lastSeq = max(conv.lastSeq, msg.Seq)
+		mm.search.Add(msg.ID, msg.ConversationID, msg.Content)
+		if msg.ThreadRoot != 0 {
+			mm.threads.add(msg.ThreadRoot, msg.ID)
+		}
+	})
+	return mm
 }
 
-// RegisterConnection 注册连接
-func (mm *MessageManager) RegisterConnection(username string, conn *websocket.Conn) {
+// RegisterConnection 注册连接，返回带发送队列的连接封装
+// 同一用户的多个设备按 session ID 区分；同一 session 重复连接时旧连接被替换并关闭。
+// ack 表示客户端在握手时选择确认下行消息，不确认的旧客户端不进入重传流程。
+func (mm *MessageManager) RegisterConnection(username, sessionID string, conn *websocket.Conn, ack bool) *Connection {
+	cfg := mm.wsConfig
+	cfg.Ack.Enabled = cfg.Ack.Enabled && ack
+	c := NewConnection(username, sessionID, conn, cfg, mm.onEvict, mm.onDelivered, mm.revisions.latest)
+
 	mm.connMutex.Lock()
-	mm.connections[username] = conn
+	devices, exists := mm.connections[username]
+	if !exists {
+		devices = make(map[string]*Connection)
+		mm.connections[username] = devices
+	}
+	old := devices[sessionID]
+	devices[sessionID] = c
 	mm.connMutex.Unlock()
 
+	if old != nil {
+		logger.Info("同一会话重复连接，关闭旧连接", zap.String("username", username), zap.String("sid", sessionID))
+		old.Close()
+	}
+
 	// 推送离线消息
-	mm.pushOfflineMessages(username, conn)
+	mm.pushOfflineMessages(username, c)
+	return c
 }
 
-// UnregisterConnection 注销连接
-func (mm *MessageManager) UnregisterConnection(username string) {
+// UnregisterConnection 注销并关闭单个设备的连接，返回该用户剩余的连接数
+func (mm *MessageManager) UnregisterConnection(c *Connection) int {
 	mm.connMutex.Lock()
-	conn := mm.connections[username]
-	if conn != nil {
-		// 关闭连接
-		conn.Close()
+	devices := mm.connections[c.Username]
+	// 只移除自身，避免误删同一 session 上已替换的新连接
+	if devices[c.SessionID] == c {
+		delete(devices, c.SessionID)
+	}
+	remaining := len(devices)
+	if remaining == 0 {
+		delete(mm.connections, c.Username)
 	}
+	mm.connMutex.Unlock()
+
+	// 关闭连接，队列中与未确认的离线消息经 onEvict 恢复为待投递
+	c.Close()
+	for _, id := range mm.leases.release(c) {
+		mm.offline.Requeue(c.Username, id)
+	}
+	return remaining
+}
+
+// UnregisterUser 注销并关闭用户所有设备的连接
+func (mm *MessageManager) UnregisterUser(username string) {
+	mm.connMutex.Lock()
+	devices := mm.connections[username]
 	delete(mm.connections, username)
 	mm.connMutex.Unlock()
+
+	for _, c := range devices {
+		c.Close()
+	}
+}
+
+// KickSession 向指定会话的连接下发 kicked 系统消息后将其断开
+func (mm *MessageManager) KickSession(username, sessionID, reason string) {
+	mm.connMutex.RLock()
+	c := mm.connections[username][sessionID]
+	mm.connMutex.RUnlock()
+	if c == nil {
+		return
+	}
+
+	logger.Info("会话被踢下线", zap.String("username", username), zap.String("sid", sessionID), zap.String("reason", reason))
+	kicked := NewSystemMessage("kicked", username, map[string]string{
+		"sid":    sessionID,
+		"reason": reason,
+	})
+	c.SendAndClose(kicked, CloseKicked, reason)
+}
+
+// KickOtherSessions 踢下线用户除 keepSessionID 以外的所有连接
+func (mm *MessageManager) KickOtherSessions(username, keepSessionID, reason string) {
+	for _, c := range mm.GetConnections(username) {
+		if c.SessionID != keepSessionID {
+			mm.KickSession(username, c.SessionID, reason)
+		}
+	}
+}
+
+// SendMessage 发送消息，返回实际发出的消息：发给多个接收者的单聊消息按接收者拆分为多条，其余为 msg 本身
+// 拆分后中途失败时同时返回已发出的消息与错误。
+// 带 client-msg-id 的消息在 idempotency_window 内按发送者去重：重试（包括与首次发送并发的重试）
+// 返回首次发送的消息，不再分配ID与扇出，与重试的内容是否相同无关。
+func (mm *MessageManager) SendMessage(msg *Message) ([]*Message, error) {
+	if len(msg.ClientMsgID) > maxClientMsgIDLen {
+		return nil, ErrInvalidClientMsgID
+	}
+	if msg.ClientMsgID == "" || mm.messageConfig.IdempotencyWindow <= 0 {
+		return mm.sendPairwise(msg)
+	}
+
+	for {
+		record, first := mm.idempotency.claim(msg.From, msg.ClientMsgID, time.Now())
+		if first {
+			sent, err := mm.sendPairwise(msg)
+			if len(sent) == 0 {
+				mm.idempotency.complete(msg.From, msg.ClientMsgID, record, nil)
+				return nil, err
+			}
+			// 部分接收者已发出时同样记录，重试返回已发出的消息而不是再发一遍
+			mm.idempotency.complete(msg.From, msg.ClientMsgID, record, sent)
+			return sent, err
+		}
+
+		<-record.done
+		if record.messages != nil {
+			return record.messages, nil
+		}
+		// 首次发送失败，重新登记
+	}
+}
+
+// sendPairwise 单聊消息按接收者拆分为一对一消息，各自属于发送者与该接收者的会话，分配独立的ID与序号
+// 首条消息沿用 msg；回复只能属于一个会话，因此带 reply-to 的单聊消息只能有一个接收者，在发出任何消息前校验。
+// 某个接收者发送失败时停止，返回已发出的消息与错误。
+func (mm *MessageManager) sendPairwise(msg *Message) ([]*Message, error) {
+	if msg.Topic != "" || len(msg.To) <= 1 {
+		if err := mm.send(msg); err != nil {
+			return nil, err
+		}
+		return []*Message{msg}, nil
+	}
+
+	recipients := make([]string, 0, len(msg.To))
+	for _, user := range msg.To {
+		if !slices.Contains(recipients, user) {
+			recipients = append(recipients, user)
+		}
+	}
+	if len(recipients) > 1 && msg.ReplyTo != 0 {
+		return nil, ErrReplyMultiRecipient
+	}
+
+	sent := make([]*Message, 0, len(recipients))
+	for i, recipient := range recipients {
+		pair := msg
+		if i > 0 {
+			pair = new(Message)
+			*pair = *msg
+		}
+		pair.To = []string{recipient}
+		if err := mm.send(pair); err != nil {
+			return sent, err
+		}
+		sent = append(sent, pair)
+	}
+	return sent, nil
 }
 
-// SendMessage 发送消息
-func (mm *MessageManager) SendMessage(msg *Message) error {
+// send 发送消息
+// 在会话锁内分配消息ID、会话内序号与发送时间并完成入队，保证三者顺序一致，接收者按序号顺序收到消息。
+// 带 reply-to 的消息归入话题串，并更新根消息的回复统计。
+func (mm *MessageManager) send(msg *Message) error {
+	if msg.Topic == "" && len(msg.To) == 0 {
+		return nil
+	}
+
+	// summary 只由离线压缩生成，muted 只按接收者的屏蔽设置标记，均不接受调用方传入的值
+	msg.Summary = nil
+	msg.Muted = false
+	msg.ConversationID = ConversationKey(msg)
+	conv := mm.conversation(msg.ConversationID)
+	conv.mutex.Lock()
+	defer conv.mutex.Unlock()
+
+	var root *Message
+	if msg.ReplyTo != 0 {
+		var err error
+		if root, err = mm.resolveThread(msg); err != nil {
+			return err
+		}
+	}
+
+	id, err := idgen.NextID()
+	if err != nil {
+		return err
+	}
+	msg.ID = id
+	msg.Seq = conv.lastSeq + 1
+	msg.CreatedAt = time.Now()
+	// 历史写入失败的消息不投递，序号留给下一条消息使用
+	if err := mm.record(msg); err != nil {
+		return err
+	}
+	conv.lastSeq = msg.Seq
+	mm.receipts.track(msg)
+	// 消息发出即结束输入状态，接收方收到消息时自行清除输入提示
+	mm.typing.stop(msg.ConversationID, msg.From)
+	var threadParticipants []string
+	if root != nil {
+		threadParticipants = mm.recordReply(root, msg)
+	}
+
 	// 单聊消息
-	if msg.Topic == "" && len(msg.To) > 0 {
+	if msg.Topic == "" {
 		return mm.sendPrivateMessage(msg)
 	}
 
 	// 群聊消息
-	if msg.Topic != "" {
-		return mm.sendTopicMessage(msg)
+	return mm.sendTopicMessage(msg, threadParticipants)
+}
+
+// record 写入历史并更新搜索索引，在会话锁内调用以保证历史记录与序号顺序一致
+func (mm *MessageManager) record(msg *Message) error {
+	evicted, err := mm.history.Append(msg)
+	if err != nil {
+		logger.Error("写入历史消息失败:", zap.Error(err), zap.String("conversation-id", msg.ConversationID), zap.Uint64("id", msg.ID))
+		return err
+	}
+	if evicted != nil {
+		mm.search.Remove(evicted.ID, evicted.Content)
+	}
+	mm.search.Add(msg.ID, msg.ConversationID, msg.Content)
+	return nil
+}
+
+// MarkRead 推进用户在会话中的已读位置，并向新读到的消息的发送者下发 receipt 系统消息
+// 群聊回执聚合为“已读人数/成员总数”。
+func (mm *MessageManager) MarkRead(username, conversationID string, messageID uint64) error {
+	participants, err := mm.participants(conversationID, username)
+	if err != nil {
+		return err
+	}
+
+	notify, err := mm.receipts.markRead(conversationID, username, messageID)
+	if err != nil {
+		return err
 	}
 
+	now := time.Now()
+	for _, record := range notify {
+		others := make([]string, 0, len(participants))
+		for _, user := range participants {
+			if user != record.From {
+				others = append(others, user)
+			}
+		}
+
+		receipt := Receipt{
+			ConversationID: conversationID,
+			MessageID:      record.ID,
+			Seq:            record.Seq,
+			Reader:         username,
+			ReadCount:      mm.receipts.readCount(conversationID, record.Seq, others),
+			Total:          len(others),
+			ReadAt:         now,
+		}
+		mm.sendSystemMessage(record.From, NewSystemMessage("receipt", record.From, receipt))
+	}
 	return nil
 }
 
+// History 分页获取会话历史消息，只有会话参与者可以读取
+// 返回ID小于 before（为 0 时从最新消息开始）的最近 limit 条消息，按ID升序排列，以及是否还有更早的消息；
+// 消息的表情回应以 username 视角标注 reacted。
+func (mm *MessageManager) History(username, conversationID string, before uint64, limit int) ([]*Message, bool, error) {
+	if _, err := mm.participants(conversationID, username); err != nil {
+		return nil, false, err
+	}
+	messages, hasMore, err := mm.history.Before(conversationID, before, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	for i, msg := range messages {
+		messages[i] = withReacted(msg, username)
+	}
+	return messages, hasMore, nil
+}
+
+// Typing 转发正在输入状态给会话中除发送者外的在线成员
+// 输入状态只下发给在线连接，不保存离线；同一会话内的频繁刷新按 min_interval 限流，
+// 超过 ttl 未刷新时自动转发 typing:false。
+func (mm *MessageManager) Typing(username string, to []string, topic string, typing bool) error {
+	if topic != "" {
+		return mm.relayConversationTyping(TopicConversationKey(topic), topic, username, typing)
+	}
+	if len(to) == 0 {
+		return ErrNotParticipant
+	}
+	// 单聊按接收者拆分为两人会话，与消息的拆分一致
+	for _, user := range to {
+		if err := mm.relayConversationTyping(P2PConversationKey(username, user), "", username, typing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relayConversationTyping 更新用户在会话中的输入状态，状态变化时转发给会话其他成员
+func (mm *MessageManager) relayConversationTyping(conversationID, topic, username string, typing bool) error {
+	participants, err := mm.participants(conversationID, username)
+	if err != nil {
+		return err
+	}
+
+	if typing {
+		if !mm.typing.start(conversationID, username) {
+			return nil
+		}
+	} else if !mm.typing.stop(conversationID, username) {
+		return nil
+	}
+	mm.relayTyping(conversationID, topic, username, participants, typing)
+	return nil
+}
+
+// onTypingExpire 输入状态超时，转发 typing:false
+func (mm *MessageManager) onTypingExpire(conversationID, username string) {
+	participants, err := mm.participants(conversationID, username)
+	if err != nil {
+		return
+	}
+	topic, _, _ := ParseConversationID(conversationID)
+	mm.relayTyping(conversationID, topic, username, participants, false)
+}
+
+// relayTyping 向会话其他成员下发 typing 帧
+func (mm *MessageManager) relayTyping(conversationID, topic, username string, participants []string, typing bool) {
+	event := TypingEvent{ConversationID: conversationID, Topic: topic, Typing: typing}
+	for _, user := range participants {
+		if user == username {
+			continue
+		}
+		frame := NewSystemMessage("typing", user, event)
+		frame.From = username
+		mm.sendSystemMessage(user, frame)
+	}
+}
+
+// SubscribePresence 订阅用户的在线状态变化
+func (mm *MessageManager) SubscribePresence(subscriber, subject string) {
+	mm.presence.subscribe(subscriber, subject)
+}
+
+// UnsubscribePresence 取消订阅用户的在线状态变化
+func (mm *MessageManager) UnsubscribePresence(subscriber, subject string) {
+	mm.presence.unsubscribe(subscriber, subject)
+}
+
+// PublishPresence 向关心该用户的在线用户下发 presence 系统消息
+// 关心者为与其同在任一 Topic 的成员以及显式订阅者；状态变化不保存离线。
+func (mm *MessageManager) PublishPresence(event PresenceEvent) {
+	audience := make(map[string]bool)
+	for _, user := range mm.topicManager.GetCoMembers(event.Username) {
+		audience[user] = true
+	}
+	for _, user := range mm.presence.of(event.Username) {
+		audience[user] = true
+	}
+	delete(audience, event.Username)
+
+	for user := range audience {
+		mm.sendSystemMessage(user, NewSystemMessage("presence", user, event))
+	}
+}
+
+// participants 获取会话参与者，并校验 username 属于该会话
+func (mm *MessageManager) participants(conversationID, username string) ([]string, error) {
+	topic, users, ok := ParseConversationID(conversationID)
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	if topic != "" {
+		users, _ = mm.topicManager.GetTopicUsers(topic)
+	}
+
+	for _, user := range users {
+		if user == username {
+			return users, nil
+		}
+	}
+	return nil, ErrNotParticipant
+}
+
+// sendSystemMessage 向用户所有在线设备下发系统消息，不在线则丢弃
+func (mm *MessageManager) sendSystemMessage(username string, frame *SystemMessage) {
+	for _, conn := range mm.GetConnections(username) {
+		if err := conn.Send(frame); err != nil {
+			logger.Warn("下发系统消息失败:", zap.Error(err), zap.String("to", username), zap.String("message-type", frame.MessageType))
+		}
+	}
+}
+
+// conversation 获取会话状态，不存在则创建
+func (mm *MessageManager) conversation(key string) *conversation {
+	mm.convMutex.Lock()
+	defer mm.convMutex.Unlock()
+
+	conv, exists := mm.conversations[key]
+	if !exists {
+		conv = &conversation{}
+		mm.conversations[key] = conv
+	}
+	return conv
+}
+
 // sendPrivateMessage 发送单聊消息
 func (mm *MessageManager) sendPrivateMessage(msg *Message) error {
 	for _, recipient := range msg.To {
-		// 检查接收者是否在线
-		mm.connMutex.RLock()
-		conn, exists := mm.connections[recipient]
-		mm.connMutex.RUnlock()
-
-		if exists {
-			// 在线，直接发送
-			if err := conn.WriteJSON(msg); err != nil {
-				logger.Error("发送单聊消息失败:", zap.Error(err), zap.String("to", recipient))
-				continue
-			}
-			logger.Info("发送单聊消息成功:", zap.String("from", msg.From), zap.String("to", recipient))
-		} else {
-			// 离线，保存离线消息
-			mm.saveOfflineMessage(recipient, msg)
-		}
+		mm.deliver(recipient, msg)
 	}
 
 	return nil
 }
 
-// sendTopicMessage 发送群聊消息
-func (mm *MessageManager) sendTopicMessage(msg *Message) error {
+// sendTopicMessage 发送群聊消息，由分发器并发扇出给Topic成员
+// 屏蔽了Topic的成员照常收到消息，只是消息标记为 muted 不提示通知；话题串回复对屏蔽了Topic的话题串参与者 threadParticipants 照常提示。
+func (mm *MessageManager) sendTopicMessage(msg *Message, threadParticipants []string) error {
 	// 获取Topic的所有用户
 	users, exists := mm.topicManager.GetTopicUsers(msg.Topic)
 	if !exists {
@@ -100,111 +524,297 @@ func (mm *MessageManager) sendTopicMessage(msg *Message) error {
 		users = []string{msg.From}
 	}
 
+	muted := mm.topicManager.GetMutedUsers(msg.Topic)
+	recipients := make([]string, 0, len(users))
+	var silent []string
 	for _, user := range users {
 		if user == msg.From {
 			continue // 跳过发送者自己
 		}
+		if muted[user] && !slices.Contains(threadParticipants, user) {
+			silent = append(silent, user)
+			continue
+		}
+		recipients = append(recipients, user)
+	}
 
-		// 检查用户是否在线
-		mm.connMutex.RLock()
-		conn, exists := mm.connections[user]
-		mm.connMutex.RUnlock()
+	mm.dispatcher.Dispatch(msg, recipients)
+	if len(silent) > 0 {
+		mm.dispatcher.Dispatch(withMuted(msg), silent)
+	}
+	return nil
+}
 
-		if exists {
-			// 在线，直接发送
-			if err := conn.WriteJSON(msg); err != nil {
-				logger.Error("发送群聊消息失败:", zap.Error(err), zap.String("to", user), zap.String("topic", msg.Topic))
-				continue
-			}
-			logger.Info("发送群聊消息成功:", zap.String("from", msg.From), zap.String("to", user), zap.String("topic", msg.Topic))
-		} else {
-			// 离线，保存离线消息
-			mm.saveOfflineMessage(user, msg)
+// deliver 向单个接收者投递消息：在线则放入其所有设备的发送队列，离线则保存离线消息
+func (mm *MessageManager) deliver(username string, msg *Message) DeliveryOutcome {
+	// 检查接收者是否在线
+	conns := mm.GetConnections(username)
+	if len(conns) == 0 {
+		// 离线，保存离线消息
+		return mm.deliverOffline(username, msg)
+	}
+
+	// 在线，放入每个设备的发送队列
+	delivered, evicted := false, false
+	for _, conn := range conns {
+		err := conn.Send(msg)
+		switch {
+		case err == nil:
+			delivered = true
+		case errors.Is(err, ErrSlowConsumer):
+			// 慢消费者驱逐的帧已由 onEvict 转存
+			evicted = true
+		default:
+			logger.Warn("投递消息失败:", zap.Error(err), zap.String("from", msg.From), zap.String("to", username), zap.String("sid", conn.SessionID))
 		}
 	}
 
-	return nil
+	if delivered {
+		logger.Info("投递消息成功:", zap.String("from", msg.From), zap.String("to", username), zap.String("topic", msg.Topic), zap.Int("devices", len(conns)))
+		return DeliveredOnline
+	}
+	if !evicted && !mm.saveOfflineMessage(username, msg) {
+		return Dropped
+	}
+	logger.Warn("所有设备投递失败，已转存离线:", zap.String("from", msg.From), zap.String("to", username), zap.String("topic", msg.Topic))
+	return QueuedOffline
+}
+
+// deliverOffline 分发队列已满时的兜底投递：直接保存离线消息，由接收者下次同步时拉取
+func (mm *MessageManager) deliverOffline(username string, msg *Message) DeliveryOutcome {
+	if !mm.saveOfflineMessage(username, msg) {
+		return Dropped
+	}
+	return QueuedOffline
 }
 
-// saveOfflineMessage 保存离线消息
-func (mm *MessageManager) saveOfflineMessage(username string, msg *Message) {
-	mm.mutex.Lock()
-	defer mm.mutex.Unlock()
+// onEvict 连接驱逐下行帧（含关闭时未确认的消息）时的回调：聊天消息转存离线，其余帧（心跳等）直接丢弃
+func (mm *MessageManager) onEvict(c *Connection, frame interface{}, reason EvictReason) {
+	switch reason {
+	case EvictDropOldest:
+		mm.evictions.dropOldest.Add(1)
+	case EvictDropNewest:
+		mm.evictions.dropNewest.Add(1)
+	case EvictDisconnect:
+		mm.evictions.disconnect.Add(1)
+	case EvictUnacked:
+		mm.evictions.unacked.Add(1)
+	default:
+		mm.evictions.closed.Add(1)
+	}
 
-	// 创建离线消息
+	for _, msg := range frameMessages(frame) {
+		// 离线回放的消息仍在离线存储中，恢复为待投递即可，不再重复保存
+		if mm.leases.remove(c, msg.ID) {
+			mm.offline.Requeue(c.Username, msg.ID)
+			continue
+		}
+		mm.saveOfflineMessage(c.Username, msg)
+	}
+}
+
+// onDelivered 消息送达时的回调：离线回放的消息送达后才从离线存储中删除
+func (mm *MessageManager) onDelivered(c *Connection, msg *Message) {
+	if mm.leases.remove(c, msg.ID) {
+		mm.offline.Commit(c.Username, msg.ID)
+	}
+}
+
+// EvictionStats 获取慢消费者驱逐统计
+func (mm *MessageManager) EvictionStats() EvictionStats {
+	return EvictionStats{
+		DropOldest: mm.evictions.dropOldest.Load(),
+		DropNewest: mm.evictions.dropNewest.Load(),
+		Disconnect: mm.evictions.disconnect.Load(),
+		Closed:     mm.evictions.closed.Load(),
+		Unacked:    mm.evictions.unacked.Load(),
+	}
+}
+
+// DispatchStats 获取分发器累计投递统计
+func (mm *MessageManager) DispatchStats() DeliveryStats {
+	return mm.dispatcher.Stats()
+}
+
+// OfflineRejection 离线消息被拒绝时发给发送者的 offline-rejected 系统消息内容
+type OfflineRejection struct {
+	MessageID      uint64 `json:"message-id"`
+	ConversationID string `json:"conversation-id"`
+	To             string `json:"to"`
+	Reason         string `json:"reason"`
+}
+
+// saveOfflineMessage 保存离线消息，返回是否保存成功
+// 离线队列已满被拒绝时，向发送者下发 offline-rejected 系统消息。
+func (mm *MessageManager) saveOfflineMessage(username string, msg *Message) bool {
+	// 驱逐或投递失败的可能是编辑、撤回前入队的旧版本
+	msg = mm.revisions.latest(msg)
 	offlineMsg := &OfflineMessage{
 		UserID:    username,
 		Message:   msg,
-		ExpiresAt: time.Now().Add(10 * time.Minute), // 10分钟过期
+		ExpiresAt: time.Now().Add(mm.offlineRetention(msg)),
 	}
 
-	// 保存到用户的离线消息列表
-	mm.offlineMessages[username] = append(mm.offlineMessages[username], offlineMsg)
+	if err := mm.offline.Put(username, offlineMsg); err != nil {
+		logger.Warn("离线队列已满，拒绝离线消息:", zap.String("to", username), zap.String("from", msg.From), zap.Uint64("id", msg.ID))
+		mm.sendSystemMessage(msg.From, NewSystemMessage("offline-rejected", msg.From, OfflineRejection{
+			MessageID:      msg.ID,
+			ConversationID: msg.ConversationID,
+			To:             username,
+			Reason:         err.Error(),
+		}))
+		return false
+	}
 	logger.Info("保存离线消息:", zap.String("to", username), zap.String("from", msg.From))
+	return true
+}
+
+// offlineRetention 消息的离线保留时间：消息指定的 ttl 只能缩短配置的保留时间
+func (mm *MessageManager) offlineRetention(msg *Message) time.Duration {
+	retention := mm.offlineConfig.TTL
+	if ttl := time.Duration(msg.TTL) * time.Second; ttl > 0 && ttl < retention {
+		retention = ttl
+	}
+	return retention
+}
+
+// SyncComplete 离线回放结束时下发的 sync-complete 系统消息内容
+type SyncComplete struct {
+	Total         int                `json:"total"`
+	Conversations []SyncConversation `json:"conversations"` // 按会话标识排序
+}
 
-	// 清理过期离线消息
-	mm.cleanupExpiredMessages()
+// SyncConversation 单个会话在本次离线回放中的消息数
+type SyncConversation struct {
+	ConversationID string `json:"conversation-id"`
+	Count          int    `json:"count"`
+	LastSeq        uint64 `json:"last-seq"`
 }
 
 // pushOfflineMessages 推送离线消息
-func (mm *MessageManager) pushOfflineMessages(username string, conn *websocket.Conn) {
-	mm.mutex.Lock()
-	messages, exists := mm.offlineMessages[username]
-	if !exists {
-		mm.mutex.Unlock()
+// 消息按ID顺序分批下发（summary 按其折叠的消息排序）（每批最多 sync_batch_size 条），全部入队后下发 sync-complete 系统消息，
+// 客户端据此得知离线积压已结束（没有离线消息时同样下发）。
+// 消息以租约方式取出，送达（客户端确认或写出成功）后才从离线存储中删除；
+// 入队失败、被驱逐或连接关闭时未送达的消息恢复为待投递，下次连接时重新推送。
+func (mm *MessageManager) pushOfflineMessages(username string, conn *Connection) {
+	leased := mm.offline.Lease(username, time.Now())
+	messages := make([]*Message, 0, len(leased))
+	for _, offlineMsg := range leased {
+		messages = append(messages, offlineMsg.Message)
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return replayOrder(messages[i]) < replayOrder(messages[j])
+	})
+
+	batchSize := mm.offlineConfig.SyncBatchSize
+	if batchSize <= 0 {
+		batchSize = len(messages)
+	}
+	for start := 0; start < len(messages); start += batchSize {
+		batch := messages[start:min(start+batchSize, len(messages))]
+		for _, msg := range batch {
+			mm.leases.add(conn, msg.ID)
+		}
+		if err := conn.SendWait(NewMessageBatch(batch), mm.wsConfig.WriteTimeout); err != nil {
+			logger.Error("推送离线消息失败，剩余消息恢复为待投递:", zap.Error(err), zap.String("to", username), zap.Int("remaining", len(messages)-start))
+			for _, msg := range messages[start:] {
+				if mm.leases.remove(conn, msg.ID) {
+					mm.offline.Requeue(username, msg.ID)
+				}
+			}
+			return
+		}
+	}
+
+	if err := conn.SendWait(NewSystemMessage("sync-complete", username, newSyncComplete(messages)), mm.wsConfig.WriteTimeout); err != nil {
+		logger.Error("下发 sync-complete 失败:", zap.Error(err), zap.String("to", username))
 		return
 	}
+	if len(messages) > 0 {
+		logger.Info("推送离线消息成功:", zap.String("to", username), zap.Int("count", len(messages)))
+	}
+}
 
-	// 清空离线消息列表
-	delete(mm.offlineMessages, username)
-	mm.mutex.Unlock()
+// replayOrder 离线回放的排序键，summary 排在其折叠的最后一条消息的位置
+func replayOrder(msg *Message) uint64 {
+	if msg.Summary != nil {
+		return msg.Summary.LastID
+	}
+	return msg.ID
+}
 
-	// 推送所有离线消息
-	for _, offlineMsg := range messages {
-		if time.Now().After(offlineMsg.ExpiresAt) {
-			continue // 跳过过期消息
+// newSyncComplete 统计本次回放中各会话的消息数，summary 按其折叠的消息数计
+func newSyncComplete(messages []*Message) SyncComplete {
+	sync := SyncComplete{Conversations: []SyncConversation{}}
+	byConversation := make(map[string]*SyncConversation)
+	for _, msg := range messages {
+		conv, exists := byConversation[msg.ConversationID]
+		if !exists {
+			conv = &SyncConversation{ConversationID: msg.ConversationID}
+			byConversation[msg.ConversationID] = conv
 		}
-
-		if err := conn.WriteJSON(offlineMsg.Message); err != nil {
-			logger.Error("推送离线消息失败:", zap.Error(err), zap.String("to", username))
-			continue
+		count := 1
+		if msg.Summary != nil {
+			count = msg.Summary.Count
 		}
-		logger.Info("推送离线消息成功:", zap.String("to", username), zap.String("from", offlineMsg.Message.From))
+		conv.Count += count
+		conv.LastSeq = max(conv.LastSeq, msg.Seq)
+		sync.Total += count
+	}
+
+	for _, conv := range byConversation {
+		sync.Conversations = append(sync.Conversations, *conv)
 	}
+	sort.Slice(sync.Conversations, func(i, j int) bool {
+		return sync.Conversations[i].ConversationID < sync.Conversations[j].ConversationID
+	})
+	return sync
 }
 
-// cleanupExpiredMessages 清理过期离线消息
-func (mm *MessageManager) cleanupExpiredMessages() {
+// CleanupExpiredMessages 定期清理过期离线消息、过期的发送去重记录与消息修改记录（供外部调用）
+func (mm *MessageManager) CleanupExpiredMessages() {
 	now := time.Now()
+	if removed := mm.offline.Expire(now); removed > 0 {
+		logger.Info("清理过期离线消息", zap.Int("count", removed))
+	}
+	if removed := mm.idempotency.expire(now); removed > 0 {
+		logger.Info("清理过期发送去重记录", zap.Int("count", removed))
+	}
+	mm.revisions.expire(now)
+}
 
-	for username, messages := range mm.offlineMessages {
-		var validMessages []*OfflineMessage
-		for _, msg := range messages {
-			if now.Before(msg.ExpiresAt) {
-				validMessages = append(validMessages, msg)
-			}
-		}
+// OfflineStats 获取离线存储统计与各用户队列深度
+func (mm *MessageManager) OfflineStats() OfflineStats {
+	return mm.offline.Stats()
+}
 
-		if len(validMessages) == 0 {
-			delete(mm.offlineMessages, username)
-		} else {
-			mm.offlineMessages[username] = validMessages
-		}
+// GetConnections 获取用户所有设备的连接
+func (mm *MessageManager) GetConnections(username string) []*Connection {
+	mm.connMutex.RLock()
+	defer mm.connMutex.RUnlock()
+
+	devices := mm.connections[username]
+	conns := make([]*Connection, 0, len(devices))
+	for _, c := range devices {
+		conns = append(conns, c)
 	}
+	return conns
 }
 
-// CleanupExpiredMessages 定期清理过期离线消息（供外部调用）
-func (mm *MessageManager) CleanupExpiredMessages() {
-	mm.mutex.Lock()
-	mm.cleanupExpiredMessages()
-	mm.mutex.Unlock()
+// TouchSession 记录会话的一次 HTTP 活动，计入该会话 WebSocket 连接的业务心跳
+func (mm *MessageManager) TouchSession(username, sessionID string) {
+	mm.connMutex.RLock()
+	c := mm.connections[username][sessionID]
+	mm.connMutex.RUnlock()
+	if c != nil {
+		c.Heartbeat().Touch(time.Now())
+	}
 }
 
-// GetConnection 获取连接
-func (mm *MessageManager) GetConnection(username string) (*websocket.Conn, bool) {
+// IsOnline 用户是否至少有一个设备在线
+func (mm *MessageManager) IsOnline(username string) bool {
 	mm.connMutex.RLock()
 	defer mm.connMutex.RUnlock()
 
-	conn, exists := mm.connections[username]
-	return conn, exists
+	return len(mm.connections[username]) > 0
 }
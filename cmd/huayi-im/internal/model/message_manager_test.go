@@ -0,0 +1,108 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+// failingHistoryStore 写入指定会话时失败的历史存储
+type failingHistoryStore struct {
+	*MemoryHistoryStore
+	failing string
+	appends int
+}
+
+func (s *failingHistoryStore) Append(msg *Message) (*Message, error) {
+	if msg.ConversationID == s.failing {
+		return nil, errors.New("disk full")
+	}
+	s.appends++
+	return s.MemoryHistoryStore.Append(msg)
+}
+
+func TestSendPairwiseSplitsRecipients(t *testing.T) {
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), NewMemoryHistoryStore(10))
+	sent, err := mm.SendMessage(&Message{From: "alice", To: []string{"bob", "carol", "bob"}, Content: "hi"})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if len(sent) != 2 || sent[0].To[0] != "bob" || sent[1].To[0] != "carol" {
+		t.Fatalf("sent = %+v, want one message per distinct recipient", sent)
+	}
+	if sent[0].ID == sent[1].ID || sent[0].ConversationID == sent[1].ConversationID || sent[0].Seq != 1 || sent[1].Seq != 1 {
+		t.Fatalf("pairs share ID or conversation: %+v, %+v", sent[0], sent[1])
+	}
+}
+
+func TestSendPairwiseRejectsMultiRecipientReply(t *testing.T) {
+	history := &failingHistoryStore{MemoryHistoryStore: NewMemoryHistoryStore(10)}
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), history)
+	root, err := mm.SendMessage(&Message{From: "alice", To: []string{"bob"}, Content: "root"})
+	if err != nil {
+		t.Fatalf("SendMessage(root): %v", err)
+	}
+
+	// 校验在发出任何消息前完成
+	_, err = mm.SendMessage(&Message{From: "alice", To: []string{"bob", "carol"}, ReplyTo: root[0].ID})
+	if !errors.Is(err, ErrReplyMultiRecipient) {
+		t.Fatalf("SendMessage(multi-recipient reply) = %v, want ErrReplyMultiRecipient", err)
+	}
+	if history.appends != 1 {
+		t.Fatalf("history appends = %d, want only the root", history.appends)
+	}
+}
+
+func TestSendPairwisePartialFailureRecorded(t *testing.T) {
+	history := &failingHistoryStore{MemoryHistoryStore: NewMemoryHistoryStore(10), failing: P2PConversationKey("alice", "carol")}
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), history)
+
+	msg := &Message{From: "alice", To: []string{"bob", "carol"}, Content: "hi", ClientMsgID: "c1"}
+	sent, err := mm.SendMessage(msg)
+	if err == nil || len(sent) != 1 || sent[0].To[0] != "bob" {
+		t.Fatalf("SendMessage = %+v, %v, want the bob pair and an error", sent, err)
+	}
+
+	// 重试返回已发出的消息，不再重复发给 bob
+	retry, err := mm.SendMessage(&Message{From: "alice", To: []string{"bob", "carol"}, Content: "hi", ClientMsgID: "c1"})
+	if err != nil || len(retry) != 1 || retry[0].ID != sent[0].ID {
+		t.Fatalf("retry = %+v, %v, want the recorded bob pair", retry, err)
+	}
+	if history.appends != 1 {
+		t.Fatalf("history appends = %d, want 1", history.appends)
+	}
+}
+
+func TestSendClearsForgedSummary(t *testing.T) {
+	offline := NewMemoryOfflineStore(config.OfflineConfig{})
+	mm := newTestMessageManager(t, offline, NewMemoryHistoryStore(10))
+	forged := &MessageSummary{FirstID: 1, LastID: 1 << 40, Count: 1000000}
+	if _, err := mm.SendMessage(&Message{From: "alice", To: []string{"bob"}, Content: "hi", Summary: forged}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	// bob 不在线，消息转存离线，不能被当作 summary 记录
+	leased := offline.Lease("bob", time.Now())
+	if len(leased) != 1 || leased[0].Message.Summary != nil {
+		t.Fatalf("offline messages = %+v, want one message without summary", leased)
+	}
+	if stats := offline.Stats(); stats.Compacted != 0 {
+		t.Fatalf("compacted = %d, want 0", stats.Compacted)
+	}
+}
+
+func TestSendClearsForgedMuted(t *testing.T) {
+	offline := NewMemoryOfflineStore(config.OfflineConfig{})
+	mm := newTestMessageManager(t, offline, NewMemoryHistoryStore(10))
+	if _, err := mm.SendMessage(&Message{From: "alice", To: []string{"bob"}, Content: "hi", Muted: true}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	// bob 没有屏蔽该会话，应照常提示
+	leased := offline.Lease("bob", time.Now())
+	if len(leased) != 1 || leased[0].Message.Muted {
+		t.Fatalf("offline messages = %+v, want one unmuted message", leased)
+	}
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/search"
+)
+
+// snippetWidth 搜索结果摘要的最大字符数
+const snippetWidth = 80
+
+// SearchQuery 消息搜索条件
+type SearchQuery struct {
+	Query  string    // 搜索词，多个词之间为“且”的关系
+	Topic  string    // 只搜索该 topic 的消息，为空时不限
+	From   string    // 只搜索该用户发送的消息，为空时不限
+	Since  time.Time // 只搜索该时间之后发送的消息，零值时不限
+	Before uint64    // 游标：只返回ID小于该值的消息，为 0 时从最新消息开始
+	Limit  int
+}
+
+// SearchHit 搜索命中的消息
+type SearchHit struct {
+	Message *Message `json:"message"`
+	Snippet string   `json:"snippet"` // 命中词附近的摘要，HTML 片段，命中词以 <mark></mark> 包裹
+}
+
+// SearchMessages 在用户可见的会话（自己参与的单聊与所在的 topic）中搜索历史消息
+// 索引只返回可见会话中的候选消息，再逐条按原文复核，排除二元组误命中。
+// 结果按消息ID从新到旧排列，返回最多 limit 条以及是否还有更早的结果。
+func (mm *MessageManager) SearchMessages(username string, q SearchQuery) ([]*SearchHit, bool, error) {
+	visible := make(map[string]bool)
+	allow := func(conversationID string) bool {
+		if q.Topic != "" && conversationID != TopicConversationKey(q.Topic) {
+			return false
+		}
+		allowed, checked := visible[conversationID]
+		if !checked {
+			_, err := mm.participants(conversationID, username)
+			allowed = err == nil
+			visible[conversationID] = allowed
+		}
+		return allowed
+	}
+	hits := make([]*SearchHit, 0, q.Limit)
+
+	for _, id := range mm.search.Search(q.Query, q.Before, allow) {
+		msg, exists, err := mm.history.Get(id)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			continue
+		}
+		// 消息ID随时间递增，之后的结果都早于 since
+		if !q.Since.IsZero() && msg.CreatedAt.Before(q.Since) {
+			break
+		}
+		if q.From != "" && msg.From != q.From {
+			continue
+		}
+		if !search.Matches(msg.Content, q.Query) {
+			continue
+		}
+
+		if len(hits) == q.Limit {
+			return hits, true, nil
+		}
+		hits = append(hits, &SearchHit{
+			Message: withReacted(msg, username),
+			Snippet: search.Snippet(msg.Content, q.Query, snippetWidth),
+		})
+	}
+	return hits, false, nil
+}
@@ -0,0 +1,499 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	diskRecordPut = "put" // 保存一条离线消息
+	diskRecordDel = "del" // 删除若干条之前保存的离线消息
+
+	diskSegmentSuffix = ".seg"
+)
+
+// diskLocation put 记录在段文件中的位置，同时作为记录的唯一标识
+type diskLocation struct {
+	Segment int   `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// diskRecord 段文件中的一行记录（JSON Lines）
+type diskRecord struct {
+	Op       string          `json:"op"`
+	Username string          `json:"username,omitempty"`
+	Message  *OfflineMessage `json:"message,omitempty"` // put：离线消息
+	Deleted  []diskLocation  `json:"deleted,omitempty"` // del：被删除的 put 记录位置
+}
+
+// diskSegment 段文件
+type diskSegment struct {
+	id   int
+	file *os.File
+	size int64
+	live int // 仍在离线队列中的 put 记录数
+}
+
+// DiskOfflineStore 基于本地段文件的离线消息存储
+// 保存、送达、丢弃与过期都以追加记录的方式写入当前段文件，超过 segment_size 后滚动到新的段文件。
+// 投递中的状态只保存在内存中，进程重启后尚未提交的消息恢复为待投递。
+// 内存中只保留每个用户的索引（记录所在的段文件与偏移），取出时再从磁盘读取消息。
+// 启动时按顺序重放全部段文件重建索引，已删除或已过期的消息不再恢复。
+// del 记录只会引用之前写入的 put 记录，因此只从最早的段文件开始删除不再有存活消息的段文件。
+// 写入后不调用 fsync，进程重启不会丢失消息，操作系统崩溃或掉电时可能丢失最近的写入。
+type DiskOfflineStore struct {
+	queues      *offlineQueues
+	dir         string
+	segmentSize int64
+	segments    []*diskSegment // 按段号升序，最后一个为当前写入的段文件
+	mutex       sync.Mutex
+}
+
+// NewDiskOfflineStore 打开离线消息目录，重放已有段文件恢复未过期的离线消息
+func NewDiskOfflineStore(cfg config.OfflineConfig) (*DiskOfflineStore, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create offline dir: %w", err)
+	}
+
+	s := &DiskOfflineStore{
+		queues:      newOfflineQueues(cfg),
+		dir:         cfg.Dir,
+		segmentSize: cfg.SegmentSize,
+	}
+	if err := s.load(time.Now()); err != nil {
+		s.closeSegments()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put 保存离线消息
+// 先追加 put 记录再检查上限，被拒绝或为腾出空间丢弃的消息随后以 del 记录删除。
+func (s *DiskOfflineStore) Put(username string, msg *OfflineMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 同一条消息在多个设备上未确认而被分别转存时只保留一份，租约按消息ID提交
+	if s.queues.contains(username, msg.Message.ID) {
+		return nil
+	}
+	msg.Size = messageSize(msg.Message)
+	if s.queues.tooLarge(msg.Size) {
+		s.queues.rejected++
+		return ErrOfflineQueueFull
+	}
+
+	entry, err := s.persist(username, msg)
+	if err != nil {
+		return err
+	}
+	dropped, err := s.queues.put(username, entry)
+	if err != nil {
+		dropped = append(dropped, entry)
+	}
+	s.remove(dropped)
+	if err != nil {
+		return err
+	}
+
+	// summary 先以 put 记录写入，再以 del 记录删除被折叠的消息
+	folded, err := s.queues.summarize(username, msg.Message.Topic, func(summary *OfflineMessage) (*offlineEntry, error) {
+		return s.persist(username, summary)
+	})
+	if err != nil {
+		logger.Error("写入离线摘要失败:", zap.Error(err), zap.String("to", username), zap.String("topic", msg.Message.Topic))
+		return nil
+	}
+	s.remove(folded)
+	return nil
+}
+
+// persist 追加 put 记录保存消息，返回其队列记录
+func (s *DiskOfflineStore) persist(username string, msg *OfflineMessage) (*offlineEntry, error) {
+	location, length, err := s.write(diskRecord{Op: diskRecordPut, Username: username, Message: msg})
+	if err != nil {
+		return nil, err
+	}
+	entry := newOfflineEntry(msg)
+	entry.message = nil
+	entry.location = location
+	entry.length = length
+	s.segment(location.Segment).live++
+	return entry, nil
+}
+
+// Lease 从段文件读取用户待投递的离线消息并标记为投递中
+// 无法读取的消息永远无法投递，直接删除。
+func (s *DiskOfflineStore) Lease(username string, now time.Time) []*OfflineMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := s.queues.lease(username, now)
+	messages := make([]*OfflineMessage, 0, len(entries))
+	var unreadable []*offlineEntry
+	for _, entry := range entries {
+		msg, err := s.read(entry)
+		if err != nil {
+			logger.Error("读取离线消息失败:", zap.Error(err), zap.String("to", username), zap.Int("segment", entry.location.Segment), zap.Int64("offset", entry.location.Offset))
+			unreadable = append(unreadable, s.queues.commit(username, entry.id))
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	s.remove(unreadable)
+	return messages
+}
+
+// Commit 追加 del 记录删除已送达的消息
+func (s *DiskOfflineStore) Commit(username string, messageID uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry := s.queues.commit(username, messageID); entry != nil {
+		s.remove([]*offlineEntry{entry})
+	}
+}
+
+// Requeue 将投递失败的消息恢复为待投递，无需写入段文件
+func (s *DiskOfflineStore) Requeue(username string, messageID uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queues.requeue(username, messageID)
+}
+
+// Rewrite 用新版本替换所有用户队列中同一ID的消息：先写入新版本的 put 记录，再以 del 记录删除旧版本
+func (s *DiskOfflineStore) Rewrite(msg *Message) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var stale []*offlineEntry
+	for _, entry := range s.queues.find(msg.ID) {
+		version := msg
+		if entry.muted {
+			version = withMuted(msg)
+		}
+		rewritten, err := s.persist(entry.username, &OfflineMessage{
+			UserID:    entry.username,
+			Message:   version,
+			ExpiresAt: entry.expiresAt,
+			Size:      messageSize(version),
+		})
+		if err != nil {
+			logger.Error("改写离线消息失败:", zap.Error(err), zap.String("to", entry.username), zap.Uint64("id", msg.ID))
+			continue
+		}
+		old := *entry
+		stale = append(stale, &old)
+		s.queues.resize(entry, rewritten.size)
+		entry.location = rewritten.location
+		entry.length = rewritten.length
+	}
+	s.remove(stale)
+	return len(stale)
+}
+
+// Expire 清理过期消息，返回清理条数
+func (s *DiskOfflineStore) Expire(now time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	removed := s.queues.expire(now)
+	s.remove(removed)
+	return len(removed)
+}
+
+// Stats 获取离线存储统计
+func (s *DiskOfflineStore) Stats() OfflineStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.queues.stats()
+	stats.Backend = OfflineBackendDisk
+	stats.Segments = len(s.segments)
+	return stats
+}
+
+// load 按段号顺序重放段文件，重建各用户的离线队列
+func (s *DiskOfflineStore) load(now time.Time) error {
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return err
+	}
+
+	type pendingPut struct {
+		username string
+		entry    *offlineEntry
+	}
+	var puts []pendingPut
+	deleted := make(map[diskLocation]bool)
+
+	for i, id := range ids {
+		segment, err := s.openSegment(id)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, segment)
+
+		err = s.replay(segment, i == len(ids)-1, func(record diskRecord, location diskLocation, length int) {
+			switch record.Op {
+			case diskRecordPut:
+				if record.Message == nil || record.Message.Message == nil {
+					return
+				}
+				msg := record.Message
+				msg.Size = messageSize(msg.Message)
+				entry := newOfflineEntry(msg)
+				entry.message = nil
+				entry.location = location
+				entry.length = length
+				puts = append(puts, pendingPut{username: record.Username, entry: entry})
+			case diskRecordDel:
+				for _, location := range record.Deleted {
+					deleted[location] = true
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// 改写在写入新版本后、删除旧版本前中断时，同一消息会有多个版本，只恢复最后写入的版本
+	type messageKey struct {
+		username string
+		id       uint64
+	}
+	latest := make(map[messageKey]diskLocation, len(puts))
+	for _, put := range puts {
+		latest[messageKey{put.username, put.entry.id}] = put.entry.location
+	}
+
+	// 重放不受上限约束：丢弃与拒绝在写入时已记录为 del
+	restored := 0
+	for _, put := range puts {
+		if deleted[put.entry.location] || now.After(put.entry.expiresAt) ||
+			latest[messageKey{put.username, put.entry.id}] != put.entry.location {
+			continue
+		}
+		s.queues.append(put.username, s.queues.queue(put.username), put.entry)
+		s.segment(put.entry.location.Segment).live++
+		restored++
+	}
+	// summary 记录写在其折叠的消息之后，恢复到被折叠的消息的位置
+	for _, queue := range s.queues.queues {
+		sort.SliceStable(queue.entries, func(i, j int) bool {
+			return queue.entries[i].order() < queue.entries[j].order()
+		})
+	}
+	s.compact()
+
+	if len(s.segments) == 0 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	logger.Info("离线消息恢复完成", zap.String("dir", s.dir), zap.Int("segments", len(s.segments)), zap.Int("messages", restored))
+	return nil
+}
+
+// replay 逐行读取段文件
+// 最后一个段文件末尾不完整的记录（写入时进程退出）被截断；无法解析的记录跳过。
+func (s *DiskOfflineStore) replay(segment *diskSegment, last bool, apply func(record diskRecord, location diskLocation, length int)) error {
+	reader := bufio.NewReader(io.NewSectionReader(segment.file, 0, segment.size))
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 && last {
+				logger.Warn("截断段文件末尾不完整的记录", zap.Int("segment", segment.id), zap.Int64("offset", offset))
+				if err := segment.file.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate offline segment %d: %w", segment.id, err)
+				}
+				segment.size = offset
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read offline segment %d: %w", segment.id, err)
+		}
+
+		var record diskRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			logger.Warn("跳过无法解析的离线记录", zap.Error(err), zap.Int("segment", segment.id), zap.Int64("offset", offset))
+		} else {
+			apply(record, diskLocation{Segment: segment.id, Offset: offset}, len(line))
+		}
+		offset += int64(len(line))
+	}
+}
+
+// write 追加一条记录，返回记录的位置与长度
+func (s *DiskOfflineStore) write(record diskRecord) (diskLocation, int, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return diskLocation{}, 0, err
+	}
+	data = append(data, '\n')
+
+	active := s.segments[len(s.segments)-1]
+	if s.segmentSize > 0 && active.size > 0 && active.size+int64(len(data)) > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return diskLocation{}, 0, err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+
+	location := diskLocation{Segment: active.id, Offset: active.size}
+	if _, err := active.file.Write(data); err != nil {
+		// 回滚写了一半的记录，保证下一条记录从完整的行开始
+		active.file.Truncate(active.size)
+		return diskLocation{}, 0, fmt.Errorf("write offline segment %d: %w", active.id, err)
+	}
+	active.size += int64(len(data))
+	return location, len(data), nil
+}
+
+// read 从段文件读取 put 记录中的离线消息
+func (s *DiskOfflineStore) read(entry *offlineEntry) (*OfflineMessage, error) {
+	segment := s.segment(entry.location.Segment)
+	if segment == nil {
+		return nil, fmt.Errorf("offline segment %d not found", entry.location.Segment)
+	}
+
+	data := make([]byte, entry.length)
+	if _, err := segment.file.ReadAt(data, entry.location.Offset); err != nil {
+		return nil, err
+	}
+	var record diskRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if record.Op != diskRecordPut || record.Message == nil || record.Message.Message == nil {
+		return nil, fmt.Errorf("unexpected offline record %q", record.Op)
+	}
+	record.Message.Size = entry.size
+	return record.Message, nil
+}
+
+// remove 追加 del 记录删除已离开队列的消息，并清理不再有存活消息的段文件
+func (s *DiskOfflineStore) remove(entries []*offlineEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	record := diskRecord{Op: diskRecordDel, Deleted: make([]diskLocation, 0, len(entries))}
+	for _, entry := range entries {
+		record.Deleted = append(record.Deleted, entry.location)
+	}
+	if _, _, err := s.write(record); err != nil {
+		// 删除记录写入失败时，这些消息在重启后会被重新投递
+		logger.Error("写入离线删除记录失败:", zap.Error(err), zap.Int("count", len(entries)))
+		return
+	}
+
+	for _, entry := range entries {
+		if segment := s.segment(entry.location.Segment); segment != nil {
+			segment.live--
+		}
+	}
+	s.compact()
+}
+
+// compact 从最早的段文件开始删除不再有存活消息的段文件，当前写入的段文件保留
+func (s *DiskOfflineStore) compact() {
+	for len(s.segments) > 1 && s.segments[0].live <= 0 {
+		segment := s.segments[0]
+		segment.file.Close()
+		if err := os.Remove(segment.file.Name()); err != nil {
+			logger.Error("删除离线段文件失败:", zap.Error(err), zap.Int("segment", segment.id))
+		}
+		s.segments[0] = nil
+		s.segments = s.segments[1:]
+	}
+}
+
+// rotate 创建新的段文件作为当前写入的段文件
+func (s *DiskOfflineStore) rotate() error {
+	id := 1
+	if len(s.segments) > 0 {
+		id = s.segments[len(s.segments)-1].id + 1
+	}
+	segment, err := s.openSegment(id)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, segment)
+	return nil
+}
+
+// openSegment 打开（不存在时创建）段文件
+func (s *DiskOfflineStore) openSegment(id int) (*diskSegment, error) {
+	path := filepath.Join(s.dir, fmt.Sprintf("%08d%s", id, diskSegmentSuffix))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open offline segment: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stat offline segment: %w", err)
+	}
+	return &diskSegment{id: id, file: file, size: info.Size()}, nil
+}
+
+// segmentIDs 目录中已有段文件的段号，升序
+func (s *DiskOfflineStore) segmentIDs() ([]int, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read offline dir: %w", err)
+	}
+
+	var ids []int
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, diskSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, diskSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// segment 按段号查找段文件
+func (s *DiskOfflineStore) segment(id int) *diskSegment {
+	i := sort.Search(len(s.segments), func(i int) bool {
+		return s.segments[i].id >= id
+	})
+	if i < len(s.segments) && s.segments[i].id == id {
+		return s.segments[i]
+	}
+	return nil
+}
+
+// closeSegments 关闭全部段文件
+func (s *DiskOfflineStore) closeSegments() {
+	for _, segment := range s.segments {
+		segment.file.Close()
+	}
+	s.segments = nil
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+func openTestDiskStore(t *testing.T, cfg config.OfflineConfig) *DiskOfflineStore {
+	t.Helper()
+	s, err := NewDiskOfflineStore(cfg)
+	if err != nil {
+		t.Fatalf("NewDiskOfflineStore: %v", err)
+	}
+	t.Cleanup(s.closeSegments)
+	return s
+}
+
+// reopenTestDiskStore 关闭段文件后重新打开，模拟进程重启
+func reopenTestDiskStore(t *testing.T, s *DiskOfflineStore, cfg config.OfflineConfig) *DiskOfflineStore {
+	t.Helper()
+	s.closeSegments()
+	return openTestDiskStore(t, cfg)
+}
+
+func TestDiskOfflineStoreReloadAfterCompaction(t *testing.T) {
+	cfg := config.OfflineConfig{Dir: t.TempDir(), Compaction: config.OfflineCompactionConfig{Threshold: 2}}
+	s := openTestDiskStore(t, cfg)
+	for id := uint64(1); id <= 5; id++ {
+		putTestMessages(t, s, newTestOfflineMessage("alice", id, "ops", "hello"))
+	}
+
+	// 重启后 summary 仍在其折叠的消息的位置，被折叠的消息不再恢复
+	s = reopenTestDiskStore(t, s, cfg)
+	leased := s.Lease("alice", time.Now())
+	if len(leased) != 3 {
+		t.Fatalf("Lease after reload = %d messages, want 3", len(leased))
+	}
+	summary := leased[0].Message.Summary
+	if summary == nil || summary.FirstID != 1 || summary.LastID != 3 || summary.Count != 3 {
+		t.Fatalf("summary after reload = %+v, want messages 1..3", summary)
+	}
+	if leased[1].Message.ID != 4 || leased[2].Message.ID != 5 {
+		t.Fatalf("Lease after reload = %v, want summary, 4, 5", messageIDs(leased))
+	}
+}
+
+func TestDiskOfflineStoreReloadAfterRewrite(t *testing.T) {
+	cfg := config.OfflineConfig{Dir: t.TempDir()}
+	s := openTestDiskStore(t, cfg)
+	muted := newTestOfflineMessage("carol", 1, "ops", "hello")
+	muted.Message = withMuted(muted.Message)
+	putTestMessages(t, s,
+		newTestOfflineMessage("alice", 1, "ops", "hello"),
+		newTestOfflineMessage("alice", 2, "ops", "world"),
+		muted,
+	)
+
+	edited := *newTestOfflineMessage("", 1, "ops", "hello, edited").Message
+	if n := s.Rewrite(&edited); n != 2 {
+		t.Fatalf("Rewrite = %d, want 2", n)
+	}
+
+	// 重启后只恢复改写后的版本，并保留位置与接收者的 muted 标记
+	s = reopenTestDiskStore(t, s, cfg)
+	leased := s.Lease("alice", time.Now())
+	if len(leased) != 2 || leased[0].Message.ID != 1 || leased[1].Message.ID != 2 {
+		t.Fatalf("Lease(alice) after reload = %v, want [1 2]", messageIDs(leased))
+	}
+	if got := leased[0].Message.Content; got != "hello, edited" {
+		t.Fatalf("content after reload = %q, want edited version", got)
+	}
+	leased = s.Lease("carol", time.Now())
+	if len(leased) != 1 || leased[0].Message.Content != "hello, edited" || !leased[0].Message.Muted {
+		t.Fatalf("Lease(carol) after reload = %+v, want edited muted version", leased)
+	}
+}
+
+func TestDiskOfflineStoreReloadSkipsRemoved(t *testing.T) {
+	cfg := config.OfflineConfig{Dir: t.TempDir()}
+	s := openTestDiskStore(t, cfg)
+	expired := newTestOfflineMessage("alice", 4, "", "expired")
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	putTestMessages(t, s,
+		newTestOfflineMessage("alice", 1, "", "one"),
+		newTestOfflineMessage("alice", 2, "", "two"),
+		newTestOfflineMessage("alice", 3, "", "three"),
+		expired,
+	)
+
+	if leased := s.Lease("alice", time.Now()); len(leased) != 3 {
+		t.Fatalf("Lease = %v, want [1 2 3]", messageIDs(leased))
+	}
+	s.Commit("alice", 1)
+	if n := s.Expire(time.Now()); n != 1 {
+		t.Fatalf("Expire = %d, want 1", n)
+	}
+
+	// 已送达与已过期的消息不再恢复，未提交的投递中消息恢复为待投递
+	s = reopenTestDiskStore(t, s, cfg)
+	leased := s.Lease("alice", time.Now())
+	if len(leased) != 2 || leased[0].Message.ID != 2 || leased[1].Message.ID != 3 {
+		t.Fatalf("Lease after reload = %v, want [2 3]", messageIDs(leased))
+	}
+}
+
+func TestDiskOfflineStoreRemovesDeadSegments(t *testing.T) {
+	// 每条记录都写入新的段文件
+	cfg := config.OfflineConfig{Dir: t.TempDir(), SegmentSize: 1}
+	s := openTestDiskStore(t, cfg)
+	putTestMessages(t, s,
+		newTestOfflineMessage("alice", 1, "", "one"),
+		newTestOfflineMessage("alice", 2, "", "two"),
+		newTestOfflineMessage("alice", 3, "", "three"),
+	)
+	if got := s.Stats().Segments; got != 3 {
+		t.Fatalf("segments after Put = %d, want 3", got)
+	}
+
+	s.Lease("alice", time.Now())
+	s.Commit("alice", 1)
+	if got := s.Stats().Segments; got != 3 {
+		t.Fatalf("segments after first Commit = %d, want 3", got)
+	}
+	s.Commit("alice", 2)
+	s.Commit("alice", 3)
+
+	// 没有存活消息的段文件都被删除，只保留当前写入的段文件
+	files, err := filepath.Glob(filepath.Join(cfg.Dir, "*"+diskSegmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Stats().Segments; got != 1 || len(files) != 1 {
+		t.Fatalf("segments after Commit = %d (%d files), want 1", got, len(files))
+	}
+
+	s = reopenTestDiskStore(t, s, cfg)
+	if stats := s.Stats(); stats.Messages != 0 || stats.Segments != 1 {
+		t.Fatalf("stats after reload = %+v, want empty store with 1 segment", stats)
+	}
+}
+
+func TestDiskOfflineStoreTruncatesPartialRecord(t *testing.T) {
+	cfg := config.OfflineConfig{Dir: t.TempDir()}
+	s := openTestDiskStore(t, cfg)
+	putTestMessages(t, s, newTestOfflineMessage("alice", 1, "", "one"))
+
+	// 模拟写入时进程退出留下的不完整记录
+	path := s.segments[len(s.segments)-1].file.Name()
+	s.closeSegments()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"op":"put","username":"alice","mess`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	s = openTestDiskStore(t, cfg)
+	putTestMessages(t, s, newTestOfflineMessage("alice", 2, "", "two"))
+	s = reopenTestDiskStore(t, s, cfg)
+	leased := s.Lease("alice", time.Now())
+	if len(leased) != 2 || leased[0].Message.ID != 1 || leased[1].Message.ID != 2 {
+		t.Fatalf("Lease after truncation = %v, want [1 2]", messageIDs(leased))
+	}
+}
@@ -0,0 +1,62 @@
+package model
+
+import "sync"
+
+// offlineLeases 各连接上已下发、尚未送达的离线消息
+// 每条离线回放的消息最终只会送达或被驱逐其一，由先到者移除并提交或恢复离线存储中的记录。
+type offlineLeases struct {
+	leases map[*Connection]map[uint64]struct{}
+	mutex  sync.Mutex
+}
+
+// newOfflineLeases 创建离线消息租约表
+func newOfflineLeases() *offlineLeases {
+	return &offlineLeases{
+		leases: make(map[*Connection]map[uint64]struct{}),
+	}
+}
+
+// add 登记下发到连接上的离线消息
+func (l *offlineLeases) add(c *Connection, messageID uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ids, exists := l.leases[c]
+	if !exists {
+		ids = make(map[uint64]struct{})
+		l.leases[c] = ids
+	}
+	ids[messageID] = struct{}{}
+}
+
+// remove 移除连接上的离线消息，返回该消息是否为离线回放的消息
+func (l *offlineLeases) remove(c *Connection, messageID uint64) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ids, exists := l.leases[c]
+	if !exists {
+		return false
+	}
+	if _, exists := ids[messageID]; !exists {
+		return false
+	}
+	delete(ids, messageID)
+	if len(ids) == 0 {
+		delete(l.leases, c)
+	}
+	return true
+}
+
+// release 连接注销时取出其上剩余的离线消息
+func (l *offlineLeases) release(c *Connection) []uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ids := make([]uint64, 0, len(l.leases[c]))
+	for id := range l.leases[c] {
+		ids = append(ids, id)
+	}
+	delete(l.leases, c)
+	return ids
+}
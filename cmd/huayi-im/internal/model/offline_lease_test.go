@@ -0,0 +1,99 @@
+package model
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+// dialTestConn 建立一对 websocket 连接，返回服务端一侧
+func dialTestConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade: %v", err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return <-accepted
+}
+
+func newTestMessageManager(t *testing.T, offline OfflineStore, history HistoryStore) *MessageManager {
+	t.Helper()
+	cfg := &config.Config{
+		WS: config.WSConfig{
+			SendQueueSize: 16,
+			WriteTimeout:  time.Second,
+			Ack:           config.AckConfig{Enabled: true, Window: 16, Timeout: time.Minute, MaxRetries: 3},
+		},
+		Offline: config.OfflineConfig{TTL: time.Hour},
+		Message: config.MessageConfig{IdempotencyWindow: time.Minute},
+		Receipt: config.ReceiptConfig{RecentLimit: 100},
+	}
+	return NewMessageManager(NewTopicManager(), offline, history, cfg)
+}
+
+func TestOfflineLeaseRequeuedOnDisconnect(t *testing.T) {
+	offline := NewMemoryOfflineStore(config.OfflineConfig{})
+	putTestMessages(t, offline,
+		newTestOfflineMessage("alice", 1, "", "one"),
+		newTestOfflineMessage("alice", 2, "", "two"),
+	)
+	mm := newTestMessageManager(t, offline, NewMemoryHistoryStore(10))
+
+	// 离线消息已下发但客户端未确认
+	c := mm.RegisterConnection("alice", "s1", dialTestConn(t), true)
+	if stats := offline.Stats(); stats.Leased != 2 {
+		t.Fatalf("leased after replay = %d, want 2", stats.Leased)
+	}
+
+	// 断开后未确认的消息恢复为待投递，不重复保存
+	mm.UnregisterConnection(c)
+	if stats := offline.Stats(); stats.Messages != 2 || stats.Leased != 0 {
+		t.Fatalf("stats after disconnect = %+v, want 2 pending messages", stats)
+	}
+	leased := offline.Lease("alice", time.Now())
+	if len(leased) != 2 || leased[0].Message.ID != 1 || leased[1].Message.ID != 2 {
+		t.Fatalf("Lease after disconnect = %v, want [1 2]", messageIDs(leased))
+	}
+}
+
+func TestOfflineLeaseCommittedOnAck(t *testing.T) {
+	offline := NewMemoryOfflineStore(config.OfflineConfig{})
+	putTestMessages(t, offline, newTestOfflineMessage("alice", 1, "", "one"))
+	mm := newTestMessageManager(t, offline, NewMemoryHistoryStore(10))
+	c := mm.RegisterConnection("alice", "s1", dialTestConn(t), true)
+
+	// 回放帧由写协程异步写出，写出前登记到未确认窗口
+	deadline := time.Now().Add(time.Second)
+	for !c.inflight.contains(1) {
+		if time.Now().After(deadline) {
+			t.Fatal("replayed message not written")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 确认后删除离线消息，随后断开不再恢复
+	if !c.Ack(1) {
+		t.Fatal("Ack(1) = false, want replayed message in flight")
+	}
+	mm.UnregisterConnection(c)
+	if stats := offline.Stats(); stats.Messages != 0 || stats.Leased != 0 {
+		t.Fatalf("stats after delivery = %+v, want empty store", stats)
+	}
+}
@@ -0,0 +1,710 @@
+package model
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/idgen"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ErrOfflineQueueFull 离线队列已达上限，消息被拒绝
+var ErrOfflineQueueFull = errors.New("offline queue full")
+
+// OfflinePolicy 离线队列达到上限时的处理策略
+type OfflinePolicy string
+
+const (
+	OfflineDropOldest OfflinePolicy = "drop-oldest" // 丢弃最早的离线消息，为新消息腾出空间
+	OfflineReject     OfflinePolicy = "reject"      // 拒绝新消息，并通知发送者
+)
+
+// 离线存储后端
+const (
+	OfflineBackendMemory = "memory" // 保存在内存中，进程重启后丢失
+	OfflineBackendDisk   = "disk"   // 追加写入本地段文件，进程重启后恢复未过期的消息
+)
+
+// OfflineStore 离线消息存储
+// 离线消息以租约方式投递：Lease 取出的消息标记为投递中但仍保留在存储中，
+// 送达后 Commit 删除，投递失败时 Requeue 恢复为待投递，进程重启前未提交的消息会再次投递。
+type OfflineStore interface {
+	// Put 保存离线消息，用户队列中已有同一ID的消息时忽略；按 reject 策略拒绝、或单条消息本身超过上限时返回 ErrOfflineQueueFull
+	Put(username string, msg *OfflineMessage) error
+	// Lease 取出用户待投递的离线消息并标记为投递中，跳过已过期的消息
+	Lease(username string, now time.Time) []*OfflineMessage
+	// Commit 投递中的消息已送达，从存储中删除
+	Commit(username string, messageID uint64)
+	// Requeue 投递中的消息投递失败，恢复为待投递
+	Requeue(username string, messageID uint64)
+	// Rewrite 用新版本替换所有用户队列中同一ID的消息（编辑或撤回），保留原有位置与过期时间，返回替换条数
+	Rewrite(msg *Message) int
+	// Expire 清理过期消息，返回清理条数
+	Expire(now time.Time) int
+	// Stats 获取离线存储统计
+	Stats() OfflineStats
+}
+
+// NewOfflineStore 按配置创建离线消息存储
+func NewOfflineStore(cfg config.OfflineConfig) (OfflineStore, error) {
+	switch cfg.Backend {
+	case "", OfflineBackendMemory:
+		return NewMemoryOfflineStore(cfg), nil
+	case OfflineBackendDisk:
+		return NewDiskOfflineStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown offline backend %q", cfg.Backend)
+	}
+}
+
+// OfflineQueueStats 单个用户的离线队列深度
+type OfflineQueueStats struct {
+	Username string    `json:"username"`
+	Messages int       `json:"messages"`
+	Bytes    int64     `json:"bytes"`
+	OldestAt time.Time `json:"oldest-at"`
+}
+
+// OfflineStats 离线存储统计
+type OfflineStats struct {
+	Backend   string              `json:"backend"`
+	Messages  int                 `json:"messages"`
+	Bytes     int64               `json:"bytes"`
+	Dropped   int64               `json:"dropped"`            // 按 drop-oldest 策略丢弃的消息数
+	Rejected  int64               `json:"rejected"`           // 按 reject 策略拒绝的消息数
+	Expired   int64               `json:"expired"`            // 过期清理的消息数
+	Compacted int64               `json:"compacted"`          // 被折叠为 summary 的消息数
+	Leased    int                 `json:"leased"`             // 已下发、等待送达确认的消息数
+	Segments  int                 `json:"segments,omitempty"` // 磁盘后端当前的段文件数
+	Queues    []OfflineQueueStats `json:"queues"`             // 按消息数降序
+}
+
+// offlineEntry 离线队列中的一条记录
+// 内存实现直接持有消息；磁盘实现只记录消息在段文件中的位置与长度，取出时再读取。
+type offlineEntry struct {
+	username  string
+	id        uint64
+	topic     string
+	summary   *MessageSummary // summary 记录折叠的消息范围
+	leased    bool            // 已下发、等待送达确认
+	muted     bool            // 接收者屏蔽了所在 topic，改写时保留 muted 标记
+	index     int             // 在过期堆中的下标，不在堆中时为 -1
+	message   *OfflineMessage
+	location  diskLocation
+	length    int
+	size      int64
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// order 记录的排序键，summary 排在其折叠的最后一条消息的位置
+func (e *offlineEntry) order() uint64 {
+	if e.summary != nil {
+		return e.summary.LastID
+	}
+	return e.id
+}
+
+// offlineQueue 单个用户的离线队列，按保存先后排序
+type offlineQueue struct {
+	entries []*offlineEntry
+	bytes   int64
+	leased  int // 投递中的记录数，这些记录不会被丢弃
+}
+
+// evictable 队列中是否有可以丢弃的记录（未在投递中）
+func (queue *offlineQueue) evictable() bool {
+	return len(queue.entries) > queue.leased
+}
+
+// offlineExpiryHeap 按过期时间排序的最小堆
+type offlineExpiryHeap []*offlineEntry
+
+func (h offlineExpiryHeap) Len() int { return len(h) }
+
+func (h offlineExpiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h offlineExpiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *offlineExpiryHeap) Push(x any) {
+	entry := x.(*offlineEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *offlineExpiryHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// offlineQueues 按用户分组的有界离线队列，负责容量限制与统计，由具体存储实现加锁
+// 同时限制每个用户和全局的消息条数与字节数（0 表示不限制）。
+// drop-oldest 策略下，超出用户上限时丢弃该用户最早的消息，超出全局上限时丢弃积压最多的用户最早的消息；
+// 投递中的记录等待送达确认或恢复，不会被丢弃。
+// 所有记录另按过期时间放入最小堆，清理时只弹出已过期的记录，无需遍历全部队列。
+type offlineQueues struct {
+	queues    map[string]*offlineQueue
+	expiry    offlineExpiryHeap
+	messages  int
+	leased    int
+	bytes     int64
+	dropped   int64
+	rejected  int64
+	expired   int64
+	compacted int64
+	limits    config.OfflineConfig
+	policy    OfflinePolicy
+}
+
+// newOfflineQueues 创建有界离线队列
+func newOfflineQueues(cfg config.OfflineConfig) *offlineQueues {
+	return &offlineQueues{
+		queues: make(map[string]*offlineQueue),
+		limits: cfg,
+		policy: OfflinePolicy(cfg.Policy),
+	}
+}
+
+// put 加入一条记录，返回为腾出空间被丢弃的记录；被拒绝时返回 ErrOfflineQueueFull
+func (q *offlineQueues) put(username string, entry *offlineEntry) ([]*offlineEntry, error) {
+	if q.tooLarge(entry.size) {
+		q.rejected++
+		return nil, ErrOfflineQueueFull
+	}
+
+	queue := q.queue(username)
+	var dropped []*offlineEntry
+	for {
+		victimName, victim := username, queue
+		if !q.userFull(queue, entry.size) {
+			if !q.globalFull(entry.size) {
+				break
+			}
+			victimName, victim = q.largestQueue()
+		}
+		if q.policy == OfflineReject || victim == nil || !victim.evictable() {
+			if len(queue.entries) == 0 {
+				delete(q.queues, username)
+			}
+			q.rejected++
+			return dropped, ErrOfflineQueueFull
+		}
+		dropped = append(dropped, q.removeOldest(victim))
+		q.dropped++
+		if victim != queue && len(victim.entries) == 0 {
+			delete(q.queues, victimName)
+		}
+	}
+
+	q.append(username, queue, entry)
+	return dropped, nil
+}
+
+// append 直接追加记录，不检查上限，用于从磁盘恢复
+func (q *offlineQueues) append(username string, queue *offlineQueue, entry *offlineEntry) {
+	entry.username = username
+	heap.Push(&q.expiry, entry)
+	queue.entries = append(queue.entries, entry)
+	queue.bytes += entry.size
+	q.messages++
+	q.bytes += entry.size
+}
+
+// queue 获取用户的离线队列，不存在时创建
+func (q *offlineQueues) queue(username string) *offlineQueue {
+	queue, exists := q.queues[username]
+	if !exists {
+		queue = &offlineQueue{}
+		q.queues[username] = queue
+	}
+	return queue
+}
+
+// lease 将用户待投递且未过期的记录标记为投递中并返回，过期记录留给 expire 清理
+func (q *offlineQueues) lease(username string, now time.Time) []*offlineEntry {
+	queue, exists := q.queues[username]
+	if !exists {
+		return nil
+	}
+
+	var leased []*offlineEntry
+	for _, entry := range queue.entries {
+		if entry.leased || now.After(entry.expiresAt) {
+			continue
+		}
+		entry.leased = true
+		leased = append(leased, entry)
+	}
+	queue.leased += len(leased)
+	q.leased += len(leased)
+	return leased
+}
+
+// summarize 用户在 topic 中的离线消息超过压缩阈值时，将较早的消息折叠为一条 summary 记录
+// 投递中的记录不参与折叠；已有的 summary 记录一并合并。persist 由具体存储实现保存 summary 消息并返回其记录，
+// 返回被折叠的记录，summary 记录插入到最早被折叠的记录的位置。
+func (q *offlineQueues) summarize(username, topic string, persist func(msg *OfflineMessage) (*offlineEntry, error)) ([]*offlineEntry, error) {
+	threshold := q.limits.Compaction.ThresholdFor(topic)
+	queue, exists := q.queues[username]
+	if topic == "" || threshold <= 0 || !exists {
+		return nil, nil
+	}
+
+	count := 0
+	for _, entry := range queue.entries {
+		if entry.topic == topic && entry.summary == nil {
+			count++
+		}
+	}
+	if count <= threshold {
+		return nil, nil
+	}
+
+	excess := count - threshold
+	var folded []*offlineEntry
+	for _, entry := range queue.entries {
+		if entry.topic != topic || entry.leased {
+			continue
+		}
+		if entry.summary != nil {
+			folded = append(folded, entry)
+			continue
+		}
+		if excess == 0 {
+			continue
+		}
+		folded = append(folded, entry)
+		excess--
+	}
+	if len(folded) < 2 {
+		return nil, nil
+	}
+
+	msg, err := newSummaryMessage(username, topic, folded)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := persist(msg)
+	if err != nil {
+		return nil, err
+	}
+	summary.username = username
+	heap.Push(&q.expiry, summary)
+
+	isFolded := make(map[*offlineEntry]bool, len(folded))
+	for _, entry := range folded {
+		isFolded[entry] = true
+		heap.Remove(&q.expiry, entry.index)
+		queue.bytes -= entry.size
+		q.bytes -= entry.size
+		if entry.summary == nil {
+			q.compacted++
+		}
+	}
+	entries := make([]*offlineEntry, 0, len(queue.entries)-len(folded)+1)
+	for _, entry := range queue.entries {
+		if !isFolded[entry] {
+			entries = append(entries, entry)
+		} else if entry == folded[0] {
+			entries = append(entries, summary)
+		}
+	}
+	queue.entries = entries
+	queue.bytes += summary.size
+	q.bytes += summary.size
+	q.messages -= len(folded) - 1
+	return folded, nil
+}
+
+// commit 删除投递中的记录并返回，记录不存在（已过期或被丢弃）时返回 nil
+func (q *offlineQueues) commit(username string, id uint64) *offlineEntry {
+	queue, i := q.findLeased(username, id)
+	if queue == nil {
+		return nil
+	}
+
+	entry := queue.entries[i]
+	copy(queue.entries[i:], queue.entries[i+1:])
+	queue.entries[len(queue.entries)-1] = nil
+	queue.entries = queue.entries[:len(queue.entries)-1]
+	heap.Remove(&q.expiry, entry.index)
+	queue.bytes -= entry.size
+	q.messages--
+	q.bytes -= entry.size
+	queue.leased--
+	q.leased--
+	if len(queue.entries) == 0 {
+		delete(q.queues, username)
+	}
+	return entry
+}
+
+// requeue 将投递中的记录恢复为待投递，保持原有顺序与过期时间
+func (q *offlineQueues) requeue(username string, id uint64) {
+	if queue, i := q.findLeased(username, id); queue != nil {
+		queue.entries[i].leased = false
+		queue.leased--
+		q.leased--
+	}
+}
+
+// contains 用户队列中是否已有指定消息ID的记录
+func (q *offlineQueues) contains(username string, id uint64) bool {
+	queue, exists := q.queues[username]
+	if !exists {
+		return false
+	}
+	return slices.ContainsFunc(queue.entries, func(entry *offlineEntry) bool { return entry.id == id })
+}
+
+// find 查找所有用户队列中指定消息ID的记录
+func (q *offlineQueues) find(id uint64) []*offlineEntry {
+	var found []*offlineEntry
+	for _, queue := range q.queues {
+		for _, entry := range queue.entries {
+			if entry.id == id {
+				found = append(found, entry)
+			}
+		}
+	}
+	return found
+}
+
+// resize 更新记录的字节数；改写已保存的消息不受上限约束
+func (q *offlineQueues) resize(entry *offlineEntry, size int64) {
+	queue := q.queues[entry.username]
+	queue.bytes += size - entry.size
+	q.bytes += size - entry.size
+	entry.size = size
+}
+
+// findLeased 查找用户队列中指定消息ID的投递中记录
+func (q *offlineQueues) findLeased(username string, id uint64) (*offlineQueue, int) {
+	queue, exists := q.queues[username]
+	if !exists {
+		return nil, -1
+	}
+	for i, entry := range queue.entries {
+		if entry.id == id && entry.leased {
+			return queue, i
+		}
+	}
+	return nil, -1
+}
+
+// expire 从过期堆中弹出已过期的记录，从所属用户的队列中移除并返回
+func (q *offlineQueues) expire(now time.Time) []*offlineEntry {
+	var removed []*offlineEntry
+	affected := make(map[string]bool)
+	for len(q.expiry) > 0 && !now.Before(q.expiry[0].expiresAt) {
+		entry := heap.Pop(&q.expiry).(*offlineEntry)
+		removed = append(removed, entry)
+		affected[entry.username] = true
+	}
+
+	// 弹出的记录 index 为 -1，每个受影响的队列只过滤一次
+	for username := range affected {
+		queue := q.queues[username]
+		valid := queue.entries[:0]
+		for _, entry := range queue.entries {
+			if entry.index >= 0 {
+				valid = append(valid, entry)
+				continue
+			}
+			queue.bytes -= entry.size
+			q.bytes -= entry.size
+			if entry.leased {
+				queue.leased--
+				q.leased--
+			}
+		}
+		clear(queue.entries[len(valid):])
+		queue.entries = valid
+
+		if len(valid) == 0 {
+			delete(q.queues, username)
+		}
+	}
+	q.messages -= len(removed)
+	q.expired += int64(len(removed))
+	return removed
+}
+
+// stats 获取统计，Backend 与 Segments 由具体实现填写
+func (q *offlineQueues) stats() OfflineStats {
+	stats := OfflineStats{
+		Messages:  q.messages,
+		Bytes:     q.bytes,
+		Dropped:   q.dropped,
+		Rejected:  q.rejected,
+		Expired:   q.expired,
+		Compacted: q.compacted,
+		Leased:    q.leased,
+		Queues:    make([]OfflineQueueStats, 0, len(q.queues)),
+	}
+	for username, queue := range q.queues {
+		if len(queue.entries) == 0 {
+			continue
+		}
+		stats.Queues = append(stats.Queues, OfflineQueueStats{
+			Username: username,
+			Messages: len(queue.entries),
+			Bytes:    queue.bytes,
+			OldestAt: queue.entries[0].createdAt,
+		})
+	}
+	sort.Slice(stats.Queues, func(i, j int) bool {
+		if stats.Queues[i].Messages != stats.Queues[j].Messages {
+			return stats.Queues[i].Messages > stats.Queues[j].Messages
+		}
+		return stats.Queues[i].Username < stats.Queues[j].Username
+	})
+	return stats
+}
+
+// tooLarge 单条消息是否超过字节上限，无论如何腾挪都无法保存
+func (q *offlineQueues) tooLarge(size int64) bool {
+	return (q.limits.MaxBytesPerUser > 0 && size > q.limits.MaxBytesPerUser) ||
+		(q.limits.MaxBytes > 0 && size > q.limits.MaxBytes)
+}
+
+// userFull 保存 size 字节的新消息是否超出用户上限
+func (q *offlineQueues) userFull(queue *offlineQueue, size int64) bool {
+	return (q.limits.MaxMessagesPerUser > 0 && len(queue.entries)+1 > q.limits.MaxMessagesPerUser) ||
+		(q.limits.MaxBytesPerUser > 0 && queue.bytes+size > q.limits.MaxBytesPerUser)
+}
+
+// globalFull 保存 size 字节的新消息是否超出全局上限
+func (q *offlineQueues) globalFull(size int64) bool {
+	return (q.limits.MaxMessages > 0 && q.messages+1 > q.limits.MaxMessages) ||
+		(q.limits.MaxBytes > 0 && q.bytes+size > q.limits.MaxBytes)
+}
+
+// largestQueue 有可丢弃记录的队列中积压字节数最多的一个，返回其用户名与队列
+func (q *offlineQueues) largestQueue() (string, *offlineQueue) {
+	var (
+		name    string
+		largest *offlineQueue
+	)
+	for username, queue := range q.queues {
+		if queue.evictable() && (largest == nil || queue.bytes > largest.bytes) {
+			name, largest = username, queue
+		}
+	}
+	return name, largest
+}
+
+// removeOldest 丢弃队列中最早的未在投递中的记录，调用方需保证队列 evictable
+func (q *offlineQueues) removeOldest(queue *offlineQueue) *offlineEntry {
+	i := slices.IndexFunc(queue.entries, func(entry *offlineEntry) bool { return !entry.leased })
+	oldest := queue.entries[i]
+	heap.Remove(&q.expiry, oldest.index)
+	queue.entries = slices.Delete(queue.entries, i, i+1)
+	queue.bytes -= oldest.size
+	q.messages--
+	q.bytes -= oldest.size
+	return oldest
+}
+
+// MemoryOfflineStore 基于内存的离线消息存储，进程重启后丢失
+type MemoryOfflineStore struct {
+	queues *offlineQueues
+	mutex  sync.Mutex
+}
+
+// NewMemoryOfflineStore 创建基于内存的离线消息存储
+func NewMemoryOfflineStore(cfg config.OfflineConfig) *MemoryOfflineStore {
+	return &MemoryOfflineStore{queues: newOfflineQueues(cfg)}
+}
+
+// Put 保存离线消息
+func (s *MemoryOfflineStore) Put(username string, msg *OfflineMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 同一条消息在多个设备上未确认而被分别转存时只保留一份，租约按消息ID提交
+	if s.queues.contains(username, msg.Message.ID) {
+		return nil
+	}
+	msg.Size = messageSize(msg.Message)
+	if _, err := s.queues.put(username, newOfflineEntry(msg)); err != nil {
+		return err
+	}
+	// 消息已保存，折叠失败只影响压缩效果，不向调用方报告
+	if _, err := s.queues.summarize(username, msg.Message.Topic, func(summary *OfflineMessage) (*offlineEntry, error) {
+		return newOfflineEntry(summary), nil
+	}); err != nil {
+		logger.Error("生成离线摘要失败:", zap.Error(err), zap.String("to", username), zap.String("topic", msg.Message.Topic))
+	}
+	return nil
+}
+
+// Lease 取出用户待投递的离线消息并标记为投递中
+func (s *MemoryOfflineStore) Lease(username string, now time.Time) []*OfflineMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := s.queues.lease(username, now)
+	messages := make([]*OfflineMessage, 0, len(entries))
+	for _, entry := range entries {
+		messages = append(messages, entry.message)
+	}
+	return messages
+}
+
+// Commit 删除已送达的消息
+func (s *MemoryOfflineStore) Commit(username string, messageID uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queues.commit(username, messageID)
+}
+
+// Requeue 将投递失败的消息恢复为待投递
+func (s *MemoryOfflineStore) Requeue(username string, messageID uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queues.requeue(username, messageID)
+}
+
+// Rewrite 用新版本替换所有用户队列中同一ID的消息
+func (s *MemoryOfflineStore) Rewrite(msg *Message) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := s.queues.find(msg.ID)
+	for _, entry := range entries {
+		version := msg
+		if entry.muted {
+			version = withMuted(msg)
+		}
+		rewritten := &OfflineMessage{
+			UserID:    entry.username,
+			Message:   version,
+			ExpiresAt: entry.expiresAt,
+			Size:      messageSize(version),
+		}
+		s.queues.resize(entry, rewritten.Size)
+		entry.message = rewritten
+	}
+	return len(entries)
+}
+
+// Expire 清理过期消息，返回清理条数
+func (s *MemoryOfflineStore) Expire(now time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.queues.expire(now))
+}
+
+// Stats 获取离线存储统计
+func (s *MemoryOfflineStore) Stats() OfflineStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.queues.stats()
+	stats.Backend = OfflineBackendMemory
+	return stats
+}
+
+// newOfflineEntry 由离线消息创建队列记录，msg.Size 需已计算
+// summary 记录的创建时间取其折叠的最早消息的时间。
+func newOfflineEntry(msg *OfflineMessage) *offlineEntry {
+	createdAt := msg.Message.CreatedAt
+	if msg.Message.Summary != nil {
+		createdAt = msg.Message.Summary.Since
+	}
+	return &offlineEntry{
+		id:        msg.Message.ID,
+		topic:     msg.Message.Topic,
+		summary:   msg.Message.Summary,
+		muted:     msg.Message.Muted,
+		index:     -1,
+		message:   msg,
+		size:      msg.Size,
+		createdAt: createdAt,
+		expiresAt: msg.ExpiresAt,
+	}
+}
+
+// newSummaryMessage 由被折叠的记录生成 summary 消息，例如 "1,243 messages in #ops since 10:02"，过期时间取被折叠记录中最早的
+func newSummaryMessage(username, topic string, folded []*offlineEntry) (*OfflineMessage, error) {
+	summary := &MessageSummary{}
+	var expiresAt time.Time
+	for _, entry := range folded {
+		first, last, since, count := entry.id, entry.id, entry.createdAt, 1
+		if entry.summary != nil {
+			first, last, since, count = entry.summary.FirstID, entry.summary.LastID, entry.summary.Since, entry.summary.Count
+		}
+		if summary.Count == 0 || first < summary.FirstID {
+			summary.FirstID = first
+			summary.Since = since
+		}
+		summary.LastID = max(summary.LastID, last)
+		summary.Count += count
+		// 取最早的过期时间，折叠不能延长任何一条消息的保留时间
+		if expiresAt.IsZero() || entry.expiresAt.Before(expiresAt) {
+			expiresAt = entry.expiresAt
+		}
+	}
+
+	id, err := idgen.NextID()
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		ID:             id,
+		ConversationID: TopicConversationKey(topic),
+		From:           "server",
+		To:             []string{username},
+		Topic:          topic,
+		ContentType:    "text/plain",
+		Content:        fmt.Sprintf("%s messages in #%s since %s", formatCount(summary.Count), topic, summary.Since.Format("15:04")),
+		MessageType:    "summary",
+		CreatedAt:      time.Now(),
+		Summary:        summary,
+	}
+	return &OfflineMessage{
+		UserID:    username,
+		Message:   msg,
+		ExpiresAt: expiresAt,
+		Size:      messageSize(msg),
+	}, nil
+}
+
+// formatCount 千分位格式的数字
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// messageSize 消息序列化后的字节数，作为离线存储的内存占用估算
+func messageSize(msg *Message) int64 {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+// newTestOfflineMessage 创建一小时后过期的 topic 离线消息
+func newTestOfflineMessage(username string, id uint64, topic, content string) *OfflineMessage {
+	now := time.Now()
+	return &OfflineMessage{
+		UserID: username,
+		Message: &Message{
+			ID:          id,
+			From:        "bob",
+			To:          []string{username},
+			Topic:       topic,
+			ContentType: "text/plain",
+			Content:     content,
+			MessageType: "text",
+			CreatedAt:   now,
+		},
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func putTestMessages(t *testing.T, s OfflineStore, msgs ...*OfflineMessage) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := s.Put(msg.UserID, msg); err != nil {
+			t.Fatalf("Put(%s, %d): %v", msg.UserID, msg.Message.ID, err)
+		}
+	}
+}
+
+func messageIDs(msgs []*OfflineMessage) []uint64 {
+	ids := make([]uint64, 0, len(msgs))
+	for _, msg := range msgs {
+		ids = append(ids, msg.Message.ID)
+	}
+	return ids
+}
+
+func TestMemoryOfflineStoreLeaseRequeueCommit(t *testing.T) {
+	s := NewMemoryOfflineStore(config.OfflineConfig{})
+	putTestMessages(t, s,
+		newTestOfflineMessage("alice", 1, "", "one"),
+		newTestOfflineMessage("alice", 2, "", "two"),
+	)
+
+	if leased := s.Lease("alice", time.Now()); len(leased) != 2 {
+		t.Fatalf("Lease = %v, want [1 2]", messageIDs(leased))
+	}
+	// 投递中的消息不会被再次取出
+	if leased := s.Lease("alice", time.Now()); len(leased) != 0 {
+		t.Fatalf("second Lease = %v, want none", messageIDs(leased))
+	}
+
+	s.Commit("alice", 1)
+	s.Requeue("alice", 2)
+	leased := s.Lease("alice", time.Now())
+	if len(leased) != 1 || leased[0].Message.ID != 2 {
+		t.Fatalf("Lease after Requeue = %v, want [2]", messageIDs(leased))
+	}
+	if stats := s.Stats(); stats.Messages != 1 || stats.Leased != 1 {
+		t.Fatalf("stats = %+v, want 1 message leased", stats)
+	}
+}
+
+func TestOfflinePutDeduplicatesByID(t *testing.T) {
+	for _, backend := range []string{OfflineBackendMemory, OfflineBackendDisk} {
+		s, err := NewOfflineStore(config.OfflineConfig{Backend: backend, Dir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("NewOfflineStore(%s): %v", backend, err)
+		}
+		putTestMessages(t, s, newTestOfflineMessage("alice", 1, "", "one"))
+		s.Lease("alice", time.Now())
+
+		// 另一个设备驱逐同一条未确认的消息
+		putTestMessages(t, s, newTestOfflineMessage("alice", 1, "", "one"))
+		if stats := s.Stats(); stats.Messages != 1 {
+			t.Fatalf("%s: messages after duplicate Put = %d, want 1", backend, stats.Messages)
+		}
+		s.Commit("alice", 1)
+		if stats := s.Stats(); stats.Messages != 0 || stats.Leased != 0 {
+			t.Fatalf("%s: stats after Commit = %+v, want empty store", backend, stats)
+		}
+		if disk, ok := s.(*DiskOfflineStore); ok {
+			disk.closeSegments()
+		}
+	}
+}
+
+func TestOfflineGlobalCapSkipsLeased(t *testing.T) {
+	s := NewMemoryOfflineStore(config.OfflineConfig{MaxMessages: 3, Policy: string(OfflineDropOldest)})
+	putTestMessages(t, s,
+		newTestOfflineMessage("alice", 1, "", "one"),
+		newTestOfflineMessage("alice", 2, "", "two"),
+		newTestOfflineMessage("bob", 3, "", "three"),
+	)
+	s.Lease("alice", time.Now())
+
+	// alice 的消息都在投递中，只能丢弃 bob 的消息；bob 的队列清空后被删除
+	putTestMessages(t, s, newTestOfflineMessage("carol", 4, "", "four"))
+	stats := s.Stats()
+	if stats.Messages != 3 || stats.Dropped != 1 {
+		t.Fatalf("stats = %+v, want 3 messages and 1 dropped", stats)
+	}
+	if _, exists := s.queues.queues["bob"]; exists {
+		t.Fatal("emptied victim queue not deleted")
+	}
+
+	// 没有可丢弃的记录时拒绝新消息
+	s.Lease("carol", time.Now())
+	if err := s.Put("dave", newTestOfflineMessage("dave", 5, "", "five")); err != ErrOfflineQueueFull {
+		t.Fatalf("Put when every entry is leased = %v, want ErrOfflineQueueFull", err)
+	}
+	if _, exists := s.queues.queues["dave"]; exists {
+		t.Fatal("rejected sender queue not deleted")
+	}
+}
+
+func TestOfflineSummaryExpiresAtEarliest(t *testing.T) {
+	s := NewMemoryOfflineStore(config.OfflineConfig{Compaction: config.OfflineCompactionConfig{Threshold: 1}})
+	early := time.Now().Add(10 * time.Minute)
+	first := newTestOfflineMessage("alice", 1, "ops", "one")
+	first.ExpiresAt = early.Add(time.Hour)
+	second := newTestOfflineMessage("alice", 2, "ops", "two")
+	second.ExpiresAt = early
+	putTestMessages(t, s, first, second, newTestOfflineMessage("alice", 3, "ops", "three"))
+
+	leased := s.Lease("alice", time.Now())
+	if len(leased) != 2 || leased[0].Message.Summary == nil {
+		t.Fatalf("Lease = %v, want summary and 3", messageIDs(leased))
+	}
+	// 折叠不能延长任何一条消息的保留时间
+	if got := leased[0].ExpiresAt; !got.Equal(early) {
+		t.Fatalf("summary expires at %v, want %v", got, early)
+	}
+}
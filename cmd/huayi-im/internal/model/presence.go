@@ -0,0 +1,108 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInvalidPresence 用户不能手动设置的在线状态
+var ErrInvalidPresence = errors.New("invalid presence status")
+
+// 在线状态：offline 与 idle 由连接和活动时间推导，away 与 dnd 由用户手动设置
+const (
+	PresenceOnline  = "online"
+	PresenceIdle    = "idle"
+	PresenceAway    = "away"
+	PresenceDND     = "dnd"
+	PresenceOffline = "offline"
+)
+
+// PresenceEvent 在线状态变化，作为 presence 系统消息的 data 下发
+type PresenceEvent struct {
+	Username   string     `json:"username"`
+	Status     string     `json:"status"`
+	StatusText string     `json:"status-text,omitempty"`  // 用户自定义状态文本
+	LastSeenAt *time.Time `json:"last-seen-at,omitempty"` // 最后在线时间，从未离线过时为空
+}
+
+// ManualPresence 校验用户手动设置的状态，online 表示清除手动状态、恢复自动推导
+func ManualPresence(status string) (string, error) {
+	switch status {
+	case PresenceOnline:
+		return "", nil
+	case PresenceAway, PresenceDND:
+		return status, nil
+	default:
+		return "", ErrInvalidPresence
+	}
+}
+
+// ResolvePresence 计算用户当前的在线状态
+// 离线优先；在线时手动设置的 away/dnd 优先；否则超过 idleAfter 无活动为 idle。
+func ResolvePresence(user *User, lastActive time.Time, idleAfter time.Duration, now time.Time) PresenceEvent {
+	event := PresenceEvent{
+		Username:   user.Username,
+		Status:     PresenceOnline,
+		StatusText: user.StatusText,
+		LastSeenAt: user.LastSeenAt,
+	}
+	switch {
+	case !user.Online:
+		event.Status = PresenceOffline
+	case user.ManualStatus != "":
+		event.Status = user.ManualStatus
+	case idleAfter > 0 && !lastActive.IsZero() && now.Sub(lastActive) >= idleAfter:
+		event.Status = PresenceIdle
+	}
+	return event
+}
+
+// presenceSubscriptions 在线状态的显式订阅关系
+type presenceSubscriptions struct {
+	subscribers map[string]map[string]bool // 被订阅者 -> 订阅者集合
+	mutex       sync.RWMutex
+}
+
+// newPresenceSubscriptions 创建订阅关系表
+func newPresenceSubscriptions() *presenceSubscriptions {
+	return &presenceSubscriptions{
+		subscribers: make(map[string]map[string]bool),
+	}
+}
+
+// subscribe 订阅 subject 的在线状态
+func (ps *presenceSubscriptions) subscribe(subscriber, subject string) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	subscribers, exists := ps.subscribers[subject]
+	if !exists {
+		subscribers = make(map[string]bool)
+		ps.subscribers[subject] = subscribers
+	}
+	subscribers[subscriber] = true
+}
+
+// unsubscribe 取消订阅
+func (ps *presenceSubscriptions) unsubscribe(subscriber, subject string) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	delete(ps.subscribers[subject], subscriber)
+	if len(ps.subscribers[subject]) == 0 {
+		delete(ps.subscribers, subject)
+	}
+}
+
+// of 获取 subject 的全部订阅者
+func (ps *presenceSubscriptions) of(subject string) []string {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	subscribers := make([]string, 0, len(ps.subscribers[subject]))
+	for subscriber := range ps.subscribers[subject] {
+		subscribers = append(subscribers, subscriber)
+	}
+	return subscribers
+}
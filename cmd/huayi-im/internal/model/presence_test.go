@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestManualPresence(t *testing.T) {
+	cases := []struct {
+		status string
+		want   string
+		err    error
+	}{
+		// online 清除手动状态
+		{PresenceOnline, "", nil},
+		{PresenceAway, PresenceAway, nil},
+		{PresenceDND, PresenceDND, nil},
+		// idle 与 offline 只能推导，不能手动设置
+		{PresenceIdle, "", ErrInvalidPresence},
+		{PresenceOffline, "", ErrInvalidPresence},
+		{"busy", "", ErrInvalidPresence},
+	}
+	for _, c := range cases {
+		got, err := ManualPresence(c.status)
+		if got != c.want || !errors.Is(err, c.err) {
+			t.Fatalf("ManualPresence(%q) = %q, %v, want %q, %v", c.status, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestResolvePresence(t *testing.T) {
+	now := time.Now()
+	idleAfter := 5 * time.Minute
+	cases := []struct {
+		name       string
+		user       User
+		lastActive time.Time
+		want       string
+	}{
+		{"offline wins over manual", User{Online: false, ManualStatus: PresenceDND}, now, PresenceOffline},
+		{"manual wins over idle", User{Online: true, ManualStatus: PresenceAway}, now.Add(-time.Hour), PresenceAway},
+		{"idle after inactivity", User{Online: true}, now.Add(-idleAfter), PresenceIdle},
+		{"active", User{Online: true}, now.Add(-time.Minute), PresenceOnline},
+		{"no activity recorded", User{Online: true}, time.Time{}, PresenceOnline},
+	}
+	for _, c := range cases {
+		c.user.Username = "alice"
+		if got := ResolvePresence(&c.user, c.lastActive, idleAfter, now); got.Status != c.want || got.Username != "alice" {
+			t.Fatalf("%s: ResolvePresence = %+v, want status %q", c.name, got, c.want)
+		}
+	}
+
+	// idleAfter 不为正时不推导 idle
+	user := &User{Username: "alice", Online: true, StatusText: "lunch"}
+	if got := ResolvePresence(user, now.Add(-time.Hour), 0, now); got.Status != PresenceOnline || got.StatusText != "lunch" {
+		t.Fatalf("ResolvePresence without idle = %+v, want online with status text", got)
+	}
+}
+
+func TestPresenceSubscriptions(t *testing.T) {
+	ps := newPresenceSubscriptions()
+	ps.subscribe("bob", "alice")
+	ps.subscribe("carol", "alice")
+	ps.subscribe("bob", "alice")
+
+	got := ps.of("alice")
+	slices.Sort(got)
+	if want := []string{"bob", "carol"}; !slices.Equal(got, want) {
+		t.Fatalf("of(alice) = %v, want %v", got, want)
+	}
+
+	ps.unsubscribe("bob", "alice")
+	ps.unsubscribe("carol", "alice")
+	if got := ps.of("alice"); len(got) != 0 {
+		t.Fatalf("of(alice) after unsubscribe = %v, want none", got)
+	}
+	if _, exists := ps.subscribers["alice"]; exists {
+		t.Fatal("empty subscriber set for alice not deleted")
+	}
+}
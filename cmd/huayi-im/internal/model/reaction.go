@@ -0,0 +1,175 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 表情回应的限制
+const (
+	maxEmojiRunes          = 16 // 单个表情的最大字符数，组合表情（如肤色、家庭）由多个码点组成
+	maxReactionsPerMessage = 50 // 单条消息上不同表情的数量上限
+)
+
+var (
+	// ErrInvalidReaction 表情为空、过长或包含空白与控制字符，或操作不是 add/remove
+	ErrInvalidReaction = errors.New("invalid reaction")
+	// ErrTooManyReactions 消息上不同表情的数量已达上限
+	ErrTooManyReactions = errors.New("too many distinct reactions on the message")
+)
+
+// 表情回应的操作
+const (
+	ReactionAdd    = "add"
+	ReactionRemove = "remove"
+)
+
+// Reaction 消息上某个表情的聚合回应，随消息一起保存在历史记录中
+type Reaction struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	Users   []string `json:"users"`             // 按回应先后排列
+	Reacted bool     `json:"reacted,omitempty"` // 查询者是否回应了该表情，只在返回给查询者时填写
+}
+
+// ReactionEvent 表情回应变更事件，作为 reaction 系统消息的 data 下发给会话参与者
+type ReactionEvent struct {
+	ConversationID string    `json:"conversation-id"`
+	MessageID      uint64    `json:"message-id"`
+	Emoji          string    `json:"emoji"`
+	User           string    `json:"user"`
+	Action         string    `json:"action"` // add/remove
+	Count          int       `json:"count"`  // 变更后该表情的回应人数
+	At             time.Time `json:"at"`
+}
+
+// React 会话参与者为消息添加或取消表情回应，返回以 username 视角标注 reacted 的消息
+// 重复添加或取消不存在的回应不产生变更，也不下发事件；发生变更时向在线参与者下发 reaction 系统消息。
+func (mm *MessageManager) React(username string, messageID uint64, emoji, action string) (*Message, error) {
+	if !validEmoji(emoji) {
+		return nil, ErrInvalidReaction
+	}
+
+	msg, exists, err := mm.history.Get(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+
+	conv := mm.conversation(msg.ConversationID)
+	conv.mutex.Lock()
+	defer conv.mutex.Unlock()
+
+	// 加锁后重新读取，避免与并发的回应、编辑互相覆盖
+	msg, exists, err = mm.history.Get(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+	if msg.RecalledAt != nil {
+		return nil, ErrMessageRecalled
+	}
+	participants, err := mm.participants(msg.ConversationID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, count, changed, err := applyReaction(msg.Reactions, username, emoji, action)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return withReacted(msg, username), nil
+	}
+
+	updated := *msg
+	updated.Reactions = reactions
+	if _, err := mm.history.Append(&updated); err != nil {
+		return nil, err
+	}
+
+	event := ReactionEvent{
+		ConversationID: updated.ConversationID,
+		MessageID:      updated.ID,
+		Emoji:          emoji,
+		User:           username,
+		Action:         action,
+		Count:          count,
+		At:             time.Now(),
+	}
+	for _, user := range participants {
+		mm.sendSystemMessage(user, NewSystemMessage("reaction", user, event))
+	}
+	return withReacted(&updated, username), nil
+}
+
+// applyReaction 在回应列表的副本上添加或取消 username 的表情回应
+// 返回新的列表、变更后该表情的回应人数，以及是否发生变更；原列表可能被其他读者引用，不做修改。
+func applyReaction(reactions []Reaction, username, emoji, action string) ([]Reaction, int, bool, error) {
+	i := slices.IndexFunc(reactions, func(r Reaction) bool { return r.Emoji == emoji })
+
+	switch action {
+	case ReactionAdd:
+		if i < 0 {
+			if len(reactions) >= maxReactionsPerMessage {
+				return nil, 0, false, ErrTooManyReactions
+			}
+			return append(slices.Clone(reactions), Reaction{Emoji: emoji, Count: 1, Users: []string{username}}), 1, true, nil
+		}
+		if slices.Contains(reactions[i].Users, username) {
+			return reactions, reactions[i].Count, false, nil
+		}
+		next := slices.Clone(reactions)
+		next[i].Users = append(slices.Clone(next[i].Users), username)
+		next[i].Count = len(next[i].Users)
+		return next, next[i].Count, true, nil
+	case ReactionRemove:
+		if i < 0 || !slices.Contains(reactions[i].Users, username) {
+			return reactions, 0, false, nil
+		}
+		users := slices.DeleteFunc(slices.Clone(reactions[i].Users), func(u string) bool { return u == username })
+		if len(users) == 0 {
+			return slices.Delete(slices.Clone(reactions), i, i+1), 0, true, nil
+		}
+		next := slices.Clone(reactions)
+		next[i].Users = users
+		next[i].Count = len(users)
+		return next, len(users), true, nil
+	default:
+		return nil, 0, false, ErrInvalidReaction
+	}
+}
+
+// withReacted 返回以 username 视角标注 reacted 的消息副本，消息没有回应时原样返回
+func withReacted(msg *Message, username string) *Message {
+	if len(msg.Reactions) == 0 {
+		return msg
+	}
+	personal := *msg
+	personal.Reactions = make([]Reaction, len(msg.Reactions))
+	for i, r := range msg.Reactions {
+		r.Reacted = slices.Contains(r.Users, username)
+		personal.Reactions[i] = r
+	}
+	return &personal
+}
+
+// validEmoji 表情不能为空、过长或包含空白与控制字符
+func validEmoji(emoji string) bool {
+	if emoji == "" || !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > maxEmojiRunes {
+		return false
+	}
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
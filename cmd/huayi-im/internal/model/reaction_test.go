@@ -0,0 +1,119 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+func TestApplyReaction(t *testing.T) {
+	reactions, count, changed, err := applyReaction(nil, "alice", "👍", ReactionAdd)
+	if err != nil || !changed || count != 1 {
+		t.Fatalf("add first = %v, %d, %v, %v", reactions, count, changed, err)
+	}
+	added, count, changed, _ := applyReaction(reactions, "bob", "👍", ReactionAdd)
+	if !changed || count != 2 || !slices.Equal(added[0].Users, []string{"alice", "bob"}) {
+		t.Fatalf("add second = %v, %d, %v", added, count, changed)
+	}
+	// 原列表可能被其他读者引用，不被修改
+	if reactions[0].Count != 1 || len(reactions[0].Users) != 1 {
+		t.Fatalf("original reactions modified: %v", reactions)
+	}
+
+	// 重复添加与取消不存在的回应不产生变更
+	if _, count, changed, _ := applyReaction(added, "bob", "👍", ReactionAdd); changed || count != 2 {
+		t.Fatalf("repeated add = %d, %v, want unchanged", count, changed)
+	}
+	if _, _, changed, _ := applyReaction(added, "carol", "👍", ReactionRemove); changed {
+		t.Fatal("removing a missing reaction changed the list")
+	}
+
+	removed, count, changed, _ := applyReaction(added, "alice", "👍", ReactionRemove)
+	if !changed || count != 1 || !slices.Equal(removed[0].Users, []string{"bob"}) {
+		t.Fatalf("remove = %v, %d, %v", removed, count, changed)
+	}
+	// 最后一人取消后删除该表情
+	if empty, _, _, _ := applyReaction(removed, "bob", "👍", ReactionRemove); len(empty) != 0 {
+		t.Fatalf("remove last = %v, want no reactions", empty)
+	}
+
+	if _, _, _, err := applyReaction(nil, "alice", "👍", "toggle"); !errors.Is(err, ErrInvalidReaction) {
+		t.Fatalf("unknown action = %v, want ErrInvalidReaction", err)
+	}
+}
+
+func TestApplyReactionLimit(t *testing.T) {
+	var reactions []Reaction
+	for i := 0; i < maxReactionsPerMessage; i++ {
+		reactions = append(reactions, Reaction{Emoji: fmt.Sprintf("e%d", i), Count: 1, Users: []string{"alice"}})
+	}
+	if _, _, _, err := applyReaction(reactions, "bob", "new", ReactionAdd); !errors.Is(err, ErrTooManyReactions) {
+		t.Fatalf("add beyond limit = %v, want ErrTooManyReactions", err)
+	}
+	// 已有表情仍可追加回应
+	if _, _, changed, err := applyReaction(reactions, "bob", "e0", ReactionAdd); err != nil || !changed {
+		t.Fatalf("add to existing emoji = %v, %v, want changed", changed, err)
+	}
+}
+
+func TestValidEmoji(t *testing.T) {
+	cases := []struct {
+		emoji string
+		want  bool
+	}{
+		{"👍", true},
+		{"👨‍👩‍👧‍👦", true},
+		{":+1:", true},
+		{"", false},
+		{"a b", false},
+		{"a\n", false},
+		{strings.Repeat("x", maxEmojiRunes+1), false},
+		{"\xff", false},
+	}
+	for _, c := range cases {
+		if got := validEmoji(c.emoji); got != c.want {
+			t.Fatalf("validEmoji(%q) = %v, want %v", c.emoji, got, c.want)
+		}
+	}
+}
+
+func TestReact(t *testing.T) {
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), NewMemoryHistoryStore(10))
+	msg := sendTestMessage(t, mm, "alice", "bob", "ship it")
+
+	reacted, err := mm.React("bob", msg.ID, "🚀", ReactionAdd)
+	if err != nil {
+		t.Fatalf("React: %v", err)
+	}
+	if len(reacted.Reactions) != 1 || !reacted.Reactions[0].Reacted {
+		t.Fatalf("reactions = %+v, want one reacted by bob", reacted.Reactions)
+	}
+
+	// 回应保存在历史中，reacted 只以查询者视角标注，不保存
+	stored, _, _ := mm.history.Get(msg.ID)
+	if len(stored.Reactions) != 1 || stored.Reactions[0].Reacted {
+		t.Fatalf("stored reactions = %+v, want one without reacted", stored.Reactions)
+	}
+	if personal := withReacted(stored, "alice"); personal.Reactions[0].Reacted {
+		t.Fatal("reacted set for a user who did not react")
+	}
+
+	if _, err := mm.React("carol", msg.ID, "🚀", ReactionAdd); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("React by outsider = %v, want ErrNotParticipant", err)
+	}
+	if _, err := mm.React("bob", msg.ID, "", ReactionAdd); !errors.Is(err, ErrInvalidReaction) {
+		t.Fatalf("React with empty emoji = %v, want ErrInvalidReaction", err)
+	}
+
+	// 撤回的消息不能再回应
+	if _, err := mm.RecallMessage("alice", msg.ID); err != nil {
+		t.Fatalf("RecallMessage: %v", err)
+	}
+	if _, err := mm.React("bob", msg.ID, "🚀", ReactionRemove); !errors.Is(err, ErrMessageRecalled) {
+		t.Fatalf("React on recalled message = %v, want ErrMessageRecalled", err)
+	}
+}
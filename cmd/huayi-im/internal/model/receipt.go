@@ -0,0 +1,148 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMessageNotFound 消息不存在或已超出跟踪范围
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrNotParticipant 用户不是会话参与者
+	ErrNotParticipant = errors.New("not a participant of the conversation")
+)
+
+// Receipt 已读回执，作为 receipt 系统消息的 data 下发给原消息发送者
+// 单聊中 Total 为除发送者外的参与者数；群聊中为除发送者外的 Topic 成员数。
+type Receipt struct {
+	ConversationID string    `json:"conversation-id"`
+	MessageID      uint64    `json:"message-id"`
+	Seq            uint64    `json:"seq"`
+	Reader         string    `json:"reader"`
+	ReadCount      int       `json:"read-count"`
+	Total          int       `json:"total"`
+	ReadAt         time.Time `json:"read-at"`
+}
+
+// readCursor 用户在会话中的已读位置
+type readCursor struct {
+	ID  uint64
+	Seq uint64
+}
+
+// sentRecord 会话中已发送消息的索引项
+type sentRecord struct {
+	ID   uint64
+	Seq  uint64
+	From string
+}
+
+// receiptTracker 已读位置与最近消息索引
+// 每个会话只保留最近 limit 条消息的 ID -> 序号映射，更早的消息不再支持回执。
+type receiptTracker struct {
+	cursors map[string]map[string]readCursor // conversation -> username -> 已读位置
+	recent  map[string][]sentRecord          // conversation -> 最近消息，按序号升序
+	limit   int
+	mutex   sync.Mutex
+}
+
+// newReceiptTracker 创建回执跟踪器
+func newReceiptTracker(limit int) *receiptTracker {
+	return &receiptTracker{
+		cursors: make(map[string]map[string]readCursor),
+		recent:  make(map[string][]sentRecord),
+		limit:   limit,
+	}
+}
+
+// track 记录新消息，须在会话锁内按序号顺序调用
+func (rt *receiptTracker) track(msg *Message) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	records := append(rt.recent[msg.ConversationID], sentRecord{ID: msg.ID, Seq: msg.Seq, From: msg.From})
+	if len(records) > rt.limit {
+		records = append([]sentRecord(nil), records[len(records)-rt.limit:]...)
+	}
+	rt.recent[msg.ConversationID] = records
+
+	// 发送者自己的消息视为已读
+	rt.advanceLocked(msg.ConversationID, msg.From, readCursor{ID: msg.ID, Seq: msg.Seq})
+}
+
+// markRead 推进用户的已读位置，返回需要通知的消息（每个发送者取其最新一条新读到的消息）
+func (rt *receiptTracker) markRead(conversationID, username string, messageID uint64) ([]sentRecord, error) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	records := rt.recent[conversationID]
+	target := -1
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ID == messageID {
+			target = i
+			break
+		}
+	}
+	if target < 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	previous := rt.cursors[conversationID][username]
+	if !rt.advanceLocked(conversationID, username, readCursor{ID: messageID, Seq: records[target].Seq}) {
+		return nil, nil
+	}
+
+	latestBySender := make(map[string]sentRecord)
+	for _, record := range records[:target+1] {
+		if record.Seq > previous.Seq && record.From != username {
+			latestBySender[record.From] = record
+		}
+	}
+
+	notify := make([]sentRecord, 0, len(latestBySender))
+	for _, record := range latestBySender {
+		notify = append(notify, record)
+	}
+	return notify, nil
+}
+
+// readCount 统计 users 中已读到 seq 的人数
+func (rt *receiptTracker) readCount(conversationID string, seq uint64, users []string) int {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	count := 0
+	for _, user := range users {
+		if cursor, exists := rt.cursors[conversationID][user]; exists && cursor.Seq >= seq {
+			count++
+		}
+	}
+	return count
+}
+
+// advanceLocked 已读位置只进不退，返回是否推进
+func (rt *receiptTracker) advanceLocked(conversationID, username string, cursor readCursor) bool {
+	cursors, exists := rt.cursors[conversationID]
+	if !exists {
+		cursors = make(map[string]readCursor)
+		rt.cursors[conversationID] = cursors
+	}
+	if cursors[username].Seq >= cursor.Seq {
+		return false
+	}
+	cursors[username] = cursor
+	return true
+}
+
+// ParseConversationID 解析会话标识，返回群聊 topic 或单聊参与者
+func ParseConversationID(conversationID string) (topic string, participants []string, ok bool) {
+	if topic, found := strings.CutPrefix(conversationID, "topic:"); found && topic != "" {
+		return topic, nil, true
+	}
+	if users, found := strings.CutPrefix(conversationID, "p2p:"); found && users != "" {
+		return "", strings.Split(users, ","), true
+	}
+	return "", nil, false
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+func TestReceiptMarkReadNotifiesLatestPerSender(t *testing.T) {
+	rt := newReceiptTracker(10)
+	for i, from := range []string{"alice", "bob", "alice", "dave"} {
+		rt.track(&Message{ID: uint64(i + 1), Seq: uint64(i + 1), From: from, ConversationID: "topic:go"})
+	}
+
+	// 每个发送者只通知其最新一条被读到的消息
+	notify, err := rt.markRead("topic:go", "carol", 3)
+	if err != nil {
+		t.Fatalf("markRead: %v", err)
+	}
+	sort.Slice(notify, func(i, j int) bool { return notify[i].ID < notify[j].ID })
+	want := []sentRecord{{ID: 2, Seq: 2, From: "bob"}, {ID: 3, Seq: 3, From: "alice"}}
+	if !slices.Equal(notify, want) {
+		t.Fatalf("notify = %v, want %v", notify, want)
+	}
+
+	// 已读位置只进不退，重复或更早的已读不再通知
+	for _, id := range []uint64{3, 2} {
+		if notify, err := rt.markRead("topic:go", "carol", id); err != nil || notify != nil {
+			t.Fatalf("markRead(%d) again = %v, %v, want nothing", id, notify, err)
+		}
+	}
+	if _, err := rt.markRead("topic:go", "carol", 99); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("markRead(unknown) = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestReceiptReadCount(t *testing.T) {
+	rt := newReceiptTracker(10)
+	rt.track(&Message{ID: 1, Seq: 1, From: "alice", ConversationID: "topic:go"})
+	rt.track(&Message{ID: 2, Seq: 2, From: "bob", ConversationID: "topic:go"})
+	if _, err := rt.markRead("topic:go", "carol", 1); err != nil {
+		t.Fatalf("markRead: %v", err)
+	}
+
+	// 发送者自己的消息视为已读
+	if got := rt.readCount("topic:go", 1, []string{"bob", "carol", "dave"}); got != 2 {
+		t.Fatalf("readCount(seq 1) = %d, want 2", got)
+	}
+	if got := rt.readCount("topic:go", 2, []string{"alice", "carol", "dave"}); got != 0 {
+		t.Fatalf("readCount(seq 2) = %d, want 0", got)
+	}
+}
+
+func TestReceiptTrackerKeepsRecentOnly(t *testing.T) {
+	rt := newReceiptTracker(2)
+	for id := uint64(1); id <= 3; id++ {
+		rt.track(&Message{ID: id, Seq: id, From: "alice", ConversationID: "p2p:alice,bob"})
+	}
+	if _, err := rt.markRead("p2p:alice,bob", "bob", 1); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("markRead(evicted) = %v, want ErrMessageNotFound", err)
+	}
+	if notify, err := rt.markRead("p2p:alice,bob", "bob", 2); err != nil || len(notify) != 1 || notify[0].ID != 2 {
+		t.Fatalf("markRead(2) = %v, %v, want message 2", notify, err)
+	}
+}
+
+func TestParseConversationID(t *testing.T) {
+	cases := []struct {
+		id           string
+		topic        string
+		participants []string
+		ok           bool
+	}{
+		{"topic:go", "go", nil, true},
+		{"p2p:alice,bob", "", []string{"alice", "bob"}, true},
+		{"topic:", "", nil, false},
+		{"p2p:", "", nil, false},
+		{"go", "", nil, false},
+	}
+	for _, c := range cases {
+		topic, participants, ok := ParseConversationID(c.id)
+		if topic != c.topic || !slices.Equal(participants, c.participants) || ok != c.ok {
+			t.Fatalf("ParseConversationID(%q) = %q, %v, %v, want %q, %v, %v", c.id, topic, participants, ok, c.topic, c.participants, c.ok)
+		}
+	}
+}
+
+func TestMarkReadRequiresParticipant(t *testing.T) {
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), NewMemoryHistoryStore(10))
+	sent, err := mm.SendMessage(&Message{From: "alice", To: []string{"bob"}, Content: "hi"})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	conversationID := sent[0].ConversationID
+
+	if err := mm.MarkRead("carol", conversationID, sent[0].ID); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("MarkRead by outsider = %v, want ErrNotParticipant", err)
+	}
+	if err := mm.MarkRead("bob", "bogus", sent[0].ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("MarkRead with bad conversation = %v, want ErrMessageNotFound", err)
+	}
+	if err := mm.MarkRead("bob", conversationID, sent[0].ID); err != nil {
+		t.Fatalf("MarkRead by recipient = %v, want nil", err)
+	}
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultRevisionRetention 未配置离线保留时间时修改记录的保留时间
+const defaultRevisionRetention = 10 * time.Minute
+
+// revision 消息被编辑或撤回后的最新版本
+type revision struct {
+	msg        *Message
+	modifiedAt time.Time
+}
+
+// revisionCache 最近被编辑或撤回的消息的最新版本
+// 发送队列、未确认窗口与离线回放批次中的消息仍是修改前的旧版本，写出或转存离线前据此替换为最新版本。
+// 旧版本在这些位置等待投递的时间不超过离线保留时间，记录保留 retention 后清理。
+type revisionCache struct {
+	retention time.Duration
+	versions  map[uint64]revision // 消息ID -> 最新版本
+	mutex     sync.RWMutex
+}
+
+func newRevisionCache(retention time.Duration) *revisionCache {
+	if retention <= 0 {
+		retention = defaultRevisionRetention
+	}
+	return &revisionCache{
+		retention: retention,
+		versions:  make(map[uint64]revision),
+	}
+}
+
+// put 记录消息的最新版本
+func (rc *revisionCache) put(msg *Message, now time.Time) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.versions[msg.ID] = revision{msg: msg, modifiedAt: now}
+}
+
+// latest 返回消息的最新版本，未被修改过时返回原消息；保留接收者的 muted 标记
+func (rc *revisionCache) latest(msg *Message) *Message {
+	rc.mutex.RLock()
+	current, exists := rc.versions[msg.ID]
+	rc.mutex.RUnlock()
+
+	switch {
+	case !exists:
+		return msg
+	case msg.Muted:
+		return withMuted(current.msg)
+	default:
+		return current.msg
+	}
+}
+
+// expire 清理超过保留时间的修改记录，返回清理的数量
+func (rc *revisionCache) expire(now time.Time) int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	removed := 0
+	for id, current := range rc.versions {
+		if now.Sub(current.modifiedAt) > rc.retention {
+			delete(rc.versions, id)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevisionLatest(t *testing.T) {
+	rc := newRevisionCache(time.Minute)
+	original := &Message{ID: 1, Content: "old"}
+	if got := rc.latest(original); got != original {
+		t.Fatalf("latest of unmodified message = %+v, want the message itself", got)
+	}
+
+	edited := &Message{ID: 1, Content: "new"}
+	rc.put(edited, time.Now())
+	if got := rc.latest(original); got != edited {
+		t.Fatalf("latest = %+v, want the edited version", got)
+	}
+
+	// 接收者的 muted 标记保留在新版本上，不修改登记的版本
+	got := rc.latest(&Message{ID: 1, Content: "old", Muted: true})
+	if got.Content != "new" || !got.Muted || edited.Muted {
+		t.Fatalf("latest of muted copy = %+v, want the edited version marked muted", got)
+	}
+}
+
+func TestRevisionExpire(t *testing.T) {
+	rc := newRevisionCache(0)
+	if rc.retention != defaultRevisionRetention {
+		t.Fatalf("retention = %v, want default %v", rc.retention, defaultRevisionRetention)
+	}
+
+	now := time.Now()
+	rc.put(&Message{ID: 1}, now.Add(-time.Hour))
+	rc.put(&Message{ID: 2}, now)
+	if removed := rc.expire(now); removed != 1 {
+		t.Fatalf("expire removed %d, want 1", removed)
+	}
+	if _, exists := rc.versions[2]; !exists {
+		t.Fatal("recent revision expired")
+	}
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrReplyNotFound 回复的消息不存在，或不属于同一会话
+	ErrReplyNotFound = errors.New("reply-to message not found in the conversation")
+	// ErrReplyMultiRecipient 回复只能属于一个会话，带 reply-to 的单聊消息只能有一个接收者
+	ErrReplyMultiRecipient = errors.New("reply-to requires a single recipient")
+)
+
+// ThreadSummary 话题串统计，保存在根消息上
+type ThreadSummary struct {
+	ReplyCount   int       `json:"reply-count"`
+	LastReplyAt  time.Time `json:"last-reply-at"`
+	Participants []string  `json:"participants"` // 根消息发送者与回复过的用户，按首次参与先后排列
+}
+
+// threadIndex 话题串索引：根消息ID -> 回复消息ID（升序）
+// 只保存在内存中，启动时由历史记录重建。
+type threadIndex struct {
+	replies map[uint64][]uint64
+	mutex   sync.RWMutex
+}
+
+func newThreadIndex() *threadIndex {
+	return &threadIndex{replies: make(map[uint64][]uint64)}
+}
+
+// add 记录话题串的一条回复，重复记录时忽略
+func (ti *threadIndex) add(root, reply uint64) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	ids := ti.replies[root]
+	i, found := slices.BinarySearch(ids, reply)
+	if !found {
+		ti.replies[root] = slices.Insert(ids, i, reply)
+	}
+}
+
+// before 返回ID小于 before（为 0 时不限）的最近 limit 条回复ID，按ID升序排列，以及是否还有更早的回复
+func (ti *threadIndex) before(root, before uint64, limit int) ([]uint64, bool) {
+	ti.mutex.RLock()
+	defer ti.mutex.RUnlock()
+
+	ids := ti.replies[root]
+	end := len(ids)
+	if before != 0 {
+		end, _ = slices.BinarySearch(ids, before)
+	}
+	start := max(end-limit, 0)
+	return slices.Clone(ids[start:end]), start > 0
+}
+
+// resolveThread 校验 msg.ReplyTo 指向同一会话中的消息，填写 msg.ThreadRoot 并返回根消息
+// 回复一条回复时归入其所在的话题串，话题串不嵌套。在会话锁内调用。
+func (mm *MessageManager) resolveThread(msg *Message) (*Message, error) {
+	parent, exists, err := mm.history.Get(msg.ReplyTo)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || parent.ConversationID != msg.ConversationID {
+		return nil, ErrReplyNotFound
+	}
+	if parent.ThreadRoot == 0 {
+		msg.ThreadRoot = parent.ID
+		return parent, nil
+	}
+
+	root, exists, err := mm.history.Get(parent.ThreadRoot)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrReplyNotFound
+	}
+	msg.ThreadRoot = root.ID
+	return root, nil
+}
+
+// recordReply 更新根消息的话题串统计并记录回复，返回更新前的话题串参与者
+// 根消息可能被其他读者引用，因此写入的是副本；在会话锁内调用，写入失败不影响投递。
+func (mm *MessageManager) recordReply(root, reply *Message) []string {
+	mm.threads.add(root.ID, reply.ID)
+
+	thread := ThreadSummary{Participants: []string{root.From}}
+	if root.Thread != nil {
+		thread = *root.Thread
+	}
+	participants := thread.Participants
+
+	thread.ReplyCount++
+	thread.LastReplyAt = reply.CreatedAt
+	if !slices.Contains(participants, reply.From) {
+		thread.Participants = append(slices.Clone(participants), reply.From)
+	}
+
+	updated := *root
+	updated.Thread = &thread
+	if _, err := mm.history.Append(&updated); err != nil {
+		logger.Error("更新话题串统计失败:", zap.Error(err), zap.Uint64("id", root.ID))
+	}
+	return participants
+}
+
+// Thread 分页获取话题串，只有会话参与者可以读取
+// messageID 可以是根消息或其中任意一条回复；返回根消息，以及ID小于 before（为 0 时从最新回复开始）的
+// 最近 limit 条回复，按ID升序排列，以及是否还有更早的回复；消息的表情回应以 username 视角标注 reacted。
+func (mm *MessageManager) Thread(username string, messageID, before uint64, limit int) (*Message, []*Message, bool, error) {
+	root, exists, err := mm.history.Get(messageID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if exists && root.ThreadRoot != 0 {
+		root, exists, err = mm.history.Get(root.ThreadRoot)
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+	if !exists {
+		return nil, nil, false, ErrMessageNotFound
+	}
+	if _, err := mm.participants(root.ConversationID, username); err != nil {
+		return nil, nil, false, err
+	}
+
+	ids, hasMore := mm.threads.before(root.ID, before, limit)
+	replies := make([]*Message, 0, len(ids))
+	for _, id := range ids {
+		reply, exists, err := mm.history.Get(id)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		// 内存历史按容量淘汰最早的消息，淘汰的回复及更早的回复都不再返回
+		if !exists {
+			hasMore = false
+			continue
+		}
+		replies = append(replies, withReacted(reply, username))
+	}
+	return withReacted(root, username), replies, hasMore, nil
+}
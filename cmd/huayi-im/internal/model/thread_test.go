@@ -0,0 +1,132 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+func TestThreadIndexBefore(t *testing.T) {
+	ti := newThreadIndex()
+	for _, id := range []uint64{3, 1, 2, 2} {
+		ti.add(10, id)
+	}
+
+	// 乱序与重复记录后仍按ID升序、不重复
+	if ids, hasMore := ti.before(10, 0, 2); !slices.Equal(ids, []uint64{2, 3}) || !hasMore {
+		t.Fatalf("before(0, 2) = %v, %v, want [2 3] and more", ids, hasMore)
+	}
+	if ids, hasMore := ti.before(10, 3, 5); !slices.Equal(ids, []uint64{1, 2}) || hasMore {
+		t.Fatalf("before(3, 5) = %v, %v, want [1 2] and no more", ids, hasMore)
+	}
+	if ids, _ := ti.before(99, 0, 5); len(ids) != 0 {
+		t.Fatalf("before on unknown root = %v, want none", ids)
+	}
+}
+
+func TestThreadReplies(t *testing.T) {
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), NewMemoryHistoryStore(10))
+	root := sendTestMessage(t, mm, "alice", "bob", "root")
+
+	first, err := mm.SendMessage(&Message{From: "bob", To: []string{"alice"}, Content: "first", ReplyTo: root.ID})
+	if err != nil {
+		t.Fatalf("SendMessage(first reply): %v", err)
+	}
+	// 回复一条回复时归入同一个话题串，话题串不嵌套
+	second, err := mm.SendMessage(&Message{From: "alice", To: []string{"bob"}, Content: "second", ReplyTo: first[0].ID})
+	if err != nil {
+		t.Fatalf("SendMessage(second reply): %v", err)
+	}
+	if first[0].ThreadRoot != root.ID || second[0].ThreadRoot != root.ID {
+		t.Fatalf("thread roots = %d, %d, want %d", first[0].ThreadRoot, second[0].ThreadRoot, root.ID)
+	}
+
+	gotRoot, replies, hasMore, err := mm.Thread("bob", second[0].ID, 0, 10)
+	if err != nil {
+		t.Fatalf("Thread: %v", err)
+	}
+	if gotRoot.ID != root.ID || hasMore || len(replies) != 2 || replies[0].ID != first[0].ID || replies[1].ID != second[0].ID {
+		t.Fatalf("Thread = %d, %v, %v, want root with both replies", gotRoot.ID, messageIDsOf(replies), hasMore)
+	}
+	summary := gotRoot.Thread
+	if summary == nil || summary.ReplyCount != 2 || !slices.Equal(summary.Participants, []string{"alice", "bob"}) {
+		t.Fatalf("thread summary = %+v, want 2 replies by alice and bob", summary)
+	}
+	// 已发出的根消息不被原地修改
+	if root.Thread != nil {
+		t.Fatal("root message modified in place")
+	}
+
+	if _, _, _, err := mm.Thread("carol", root.ID, 0, 10); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("Thread by outsider = %v, want ErrNotParticipant", err)
+	}
+}
+
+func TestThreadReplyOtherConversation(t *testing.T) {
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), NewMemoryHistoryStore(10))
+	root := sendTestMessage(t, mm, "alice", "bob", "root")
+
+	_, err := mm.SendMessage(&Message{From: "alice", To: []string{"carol"}, Content: "reply", ReplyTo: root.ID})
+	if !errors.Is(err, ErrReplyNotFound) {
+		t.Fatalf("reply across conversations = %v, want ErrReplyNotFound", err)
+	}
+}
+
+func TestThreadNotifiesMutedParticipants(t *testing.T) {
+	offline := NewMemoryOfflineStore(config.OfflineConfig{})
+	mm := newTestMessageManager(t, offline, NewMemoryHistoryStore(10))
+	for _, user := range []string{"alice", "bob", "carol"} {
+		mm.topicManager.AddUserToTopic("go", user)
+	}
+	mm.topicManager.SetMuted("go", "bob", true)
+	mm.topicManager.SetMuted("go", "carol", true)
+
+	send := func(from string, replyTo uint64) *Message {
+		sent, err := mm.SendMessage(&Message{From: from, Topic: "go", Content: "hi", ReplyTo: replyTo})
+		if err != nil {
+			t.Fatalf("SendMessage: %v", err)
+		}
+		return sent[0]
+	}
+	root := send("alice", 0)
+	send("bob", root.ID)
+	reply := send("alice", root.ID)
+
+	// 群聊消息由分发器异步扇出，等待全部转存离线
+	deadline := time.Now().Add(time.Second)
+	for offline.Stats().Messages < 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("offline messages = %d, want 6", offline.Stats().Messages)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 屏蔽了 topic 的 bob 参与过话题串，照常收到提示；carol 没有参与，只收到静默消息
+	muted := func(username string, id uint64) bool {
+		for _, leased := range offline.Lease(username, time.Now()) {
+			if leased.Message.ID == id {
+				return leased.Message.Muted
+			}
+		}
+		t.Fatalf("%s did not receive message %d", username, id)
+		return false
+	}
+	if muted("bob", reply.ID) {
+		t.Fatal("thread reply muted for a muted thread participant")
+	}
+	if !muted("carol", reply.ID) {
+		t.Fatal("thread reply not muted for a muted non-participant")
+	}
+}
+
+// messageIDsOf 消息的ID列表
+func messageIDsOf(messages []*Message) []uint64 {
+	ids := make([]uint64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
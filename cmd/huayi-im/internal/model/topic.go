@@ -1,14 +1,17 @@
 package model
 
 import (
+	"maps"
+	"slices"
 	"sync"
 )
 
 // Topic 话题模型
 type Topic struct {
-	Name      string   `json:"name"`
-	Users     []string `json:"users"`
-	CreatedAt string   `json:"created_at"`
+	Name      string          `json:"name"`
+	Users     []string        `json:"users"`
+	CreatedAt string          `json:"created_at"`
+	muted     map[string]bool // 屏蔽了该Topic的成员，普通消息标记为 muted 静默投递，所参与话题串的回复照常提示
 }
 
 // TopicManager Topic管理器
@@ -109,6 +112,7 @@ func (tm *TopicManager) RemoveUserFromTopic(topicName, username string) {
 			break
 		}
 	}
+	delete(topic.muted, username)
 
 	// 如果Topic中没有用户了，删除Topic
 	if len(topic.Users) == 0 {
@@ -158,3 +162,64 @@ func (tm *TopicManager) IsUserInTopic(topicName, username string) bool {
 	}
 	return false
 }
+
+// SetMuted 设置成员是否屏蔽Topic，Topic不存在或用户不在Topic中时返回 false
+func (tm *TopicManager) SetMuted(topicName, username string, muted bool) bool {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	topic, exists := tm.topics[topicName]
+	if !exists || !slices.Contains(topic.Users, username) {
+		return false
+	}
+
+	if !muted {
+		delete(topic.muted, username)
+		return true
+	}
+	if topic.muted == nil {
+		topic.muted = make(map[string]bool)
+	}
+	topic.muted[username] = true
+	return true
+}
+
+// GetMutedUsers 获取屏蔽了Topic的成员
+func (tm *TopicManager) GetMutedUsers(topicName string) map[string]bool {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	topic, exists := tm.topics[topicName]
+	if !exists {
+		return nil
+	}
+	return maps.Clone(topic.muted)
+}
+
+// GetCoMembers 获取与用户同在至少一个Topic中的其他用户
+func (tm *TopicManager) GetCoMembers(username string) []string {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var members []string
+	for _, topic := range tm.topics {
+		joined := false
+		for _, user := range topic.Users {
+			if user == username {
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			continue
+		}
+		for _, user := range topic.Users {
+			if user != username && !seen[user] {
+				seen[user] = true
+				members = append(members, user)
+			}
+		}
+	}
+	return members
+}
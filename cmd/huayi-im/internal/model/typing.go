@@ -0,0 +1,100 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// TypingEvent 正在输入状态，作为 typing 帧的 data 转发给会话其他在线成员
+type TypingEvent struct {
+	ConversationID string `json:"conversation-id"`
+	Topic          string `json:"topic,omitempty"`
+	Typing         bool   `json:"typing"`
+}
+
+// typingState 单个用户在单个会话中的输入状态
+type typingState struct {
+	lastRelay time.Time   // 上次转发 typing:true 的时间
+	expiresAt time.Time   // 输入状态过期时间
+	timer     *time.Timer // 超时未刷新则自动结束输入状态
+}
+
+// typingTracker 输入状态跟踪器
+// 同一用户在同一会话中 minInterval 内的重复 typing:true 只刷新过期时间，不再转发；
+// 超过 ttl 未刷新时回调 onExpire，由调用方转发 typing:false。
+type typingTracker struct {
+	states      map[string]*typingState // conversation + username -> 输入状态
+	ttl         time.Duration
+	minInterval time.Duration
+	onExpire    func(conversationID, username string)
+	mutex       sync.Mutex
+}
+
+// newTypingTracker 创建输入状态跟踪器
+func newTypingTracker(ttl, minInterval time.Duration, onExpire func(conversationID, username string)) *typingTracker {
+	return &typingTracker{
+		states:      make(map[string]*typingState),
+		ttl:         ttl,
+		minInterval: minInterval,
+		onExpire:    onExpire,
+	}
+}
+
+// start 开始或刷新输入状态，返回是否需要转发
+func (tt *typingTracker) start(conversationID, username string) bool {
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+
+	now := time.Now()
+	key := typingKey(conversationID, username)
+	state, exists := tt.states[key]
+	if !exists {
+		state = &typingState{}
+		tt.states[key] = state
+		state.timer = time.AfterFunc(tt.ttl, func() {
+			tt.expire(conversationID, username, state)
+		})
+	} else {
+		state.timer.Reset(tt.ttl)
+	}
+	state.expiresAt = now.Add(tt.ttl)
+
+	if exists && now.Sub(state.lastRelay) < tt.minInterval {
+		return false
+	}
+	state.lastRelay = now
+	return true
+}
+
+// stop 结束输入状态，返回此前是否处于输入中
+func (tt *typingTracker) stop(conversationID, username string) bool {
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+
+	key := typingKey(conversationID, username)
+	state, exists := tt.states[key]
+	if !exists {
+		return false
+	}
+	state.timer.Stop()
+	delete(tt.states, key)
+	return true
+}
+
+// expire 输入状态超时；状态已被 stop、替换或在定时器触发后刚被刷新时忽略
+func (tt *typingTracker) expire(conversationID, username string, state *typingState) {
+	tt.mutex.Lock()
+	key := typingKey(conversationID, username)
+	if tt.states[key] != state || time.Now().Before(state.expiresAt) {
+		tt.mutex.Unlock()
+		return
+	}
+	delete(tt.states, key)
+	tt.mutex.Unlock()
+
+	tt.onExpire(conversationID, username)
+}
+
+func typingKey(conversationID, username string) string {
+	return conversationID + "\x00" + username
+}
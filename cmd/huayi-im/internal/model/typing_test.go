@@ -0,0 +1,85 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+)
+
+func TestTypingRateLimited(t *testing.T) {
+	tt := newTypingTracker(time.Minute, time.Minute, func(string, string) {})
+
+	// min_interval 内的重复 typing:true 只刷新，不转发
+	if !tt.start("topic:go", "alice") {
+		t.Fatal("first start = false, want relay")
+	}
+	if tt.start("topic:go", "alice") {
+		t.Fatal("repeated start = true, want rate limited")
+	}
+	if !tt.start("topic:go", "bob") || !tt.start("topic:rust", "alice") {
+		t.Fatal("start in another conversation or by another user was rate limited")
+	}
+
+	if !tt.stop("topic:go", "alice") || tt.stop("topic:go", "alice") {
+		t.Fatal("stop should succeed exactly once")
+	}
+	if !tt.start("topic:go", "alice") {
+		t.Fatal("start after stop = false, want relay")
+	}
+}
+
+func TestTypingExpires(t *testing.T) {
+	expired := make(chan string, 1)
+	tt := newTypingTracker(50*time.Millisecond, time.Minute, func(conversationID, username string) {
+		expired <- conversationID + "/" + username
+	})
+
+	tt.start("topic:go", "alice")
+	select {
+	case got := <-expired:
+		if got != "topic:go/alice" {
+			t.Fatalf("expired %q, want topic:go/alice", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("typing state did not expire")
+	}
+	if tt.stop("topic:go", "alice") {
+		t.Fatal("stop after expiry = true, want state removed")
+	}
+}
+
+func TestTypingExpireIgnoresStaleTimer(t *testing.T) {
+	expired := 0
+	tt := newTypingTracker(time.Minute, 0, func(string, string) { expired++ })
+	tt.start("topic:go", "alice")
+	state := tt.states[typingKey("topic:go", "alice")]
+
+	// 定时器触发时状态刚被刷新，不结束输入状态
+	tt.expire("topic:go", "alice", state)
+	if expired != 0 || tt.states[typingKey("topic:go", "alice")] != state {
+		t.Fatal("refreshed typing state expired")
+	}
+
+	// 已被 stop 的旧状态同样忽略
+	tt.stop("topic:go", "alice")
+	state.expiresAt = time.Time{}
+	tt.expire("topic:go", "alice", state)
+	if expired != 0 {
+		t.Fatal("stopped typing state expired")
+	}
+}
+
+func TestTypingRequiresParticipant(t *testing.T) {
+	mm := newTestMessageManager(t, NewMemoryOfflineStore(config.OfflineConfig{}), NewMemoryHistoryStore(10))
+	mm.topicManager.CreateTopic("go")
+	mm.topicManager.AddUserToTopic("go", "alice")
+
+	if err := mm.Typing("bob", nil, "go", true); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("Typing in topic by outsider = %v, want ErrNotParticipant", err)
+	}
+	if err := mm.Typing("alice", nil, "", true); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("Typing without recipients = %v, want ErrNotParticipant", err)
+	}
+}
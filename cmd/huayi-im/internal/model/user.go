@@ -6,11 +6,14 @@ import (
 
 // User 用户模型（GORM）
 type User struct {
-	ID               uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
-	Username         string    `gorm:"size:50;uniqueIndex;not null" json:"username"`
-	LastAskId        int64     `gorm:"default:0" json:"last_ask_id"`        // 最后一次请求ID
-	NonResponseCount int       `gorm:"default:0" json:"non_response_count"` // 无响应次数
-	Online           bool      `gorm:"default:false" json:"online"`         // 在线状态
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username         string     `gorm:"size:50;uniqueIndex;not null" json:"username"`
+	LastAskId        int64      `gorm:"default:0" json:"last_ask_id"`        // 最后一次请求ID
+	NonResponseCount int        `gorm:"default:0" json:"non_response_count"` // 无响应次数
+	Online           bool       `gorm:"default:false" json:"online"`         // 在线状态
+	LastSeenAt       *time.Time `json:"last_seen_at,omitempty"`              // 最后在线时间，离线时更新
+	ManualStatus     string     `gorm:"size:16" json:"-"`                    // 手动设置的状态 away/dnd，空表示自动推导
+	StatusText       string     `gorm:"size:100" json:"-"`                   // 自定义状态文本
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
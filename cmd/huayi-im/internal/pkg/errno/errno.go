@@ -21,6 +21,7 @@ var (
 	UserNotFound = &errno{code: 404, message: "用户不存在"}
 	UserExists   = &errno{code: 400, message: "用户已存在"}
 	Unauthorized = &errno{code: 401, message: "未授权"}
+	Forbidden    = &errno{code: 403, message: "无权访问"}
 	NotFound     = &errno{code: 404, message: "资源不存在"}
 )
 
@@ -0,0 +1,112 @@
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 雪花算法ID布局：41位毫秒时间戳 + 4位节点ID + 8位序列号，共53位
+// 限制在 2^53 以内，保证浏览器端 JSON.parse 得到的数字精确，可直接用于 ack-id。
+const (
+	nodeBits     = 4
+	sequenceBits = 8
+
+	maxNode     = -1 ^ (-1 << nodeBits)
+	maxSequence = -1 ^ (-1 << sequenceBits)
+
+	timeShift = nodeBits + sequenceBits
+	nodeShift = sequenceBits
+)
+
+// maxDrift 逻辑时间戳领先系统时钟的上限（毫秒）
+// 序列号用尽或时钟回拨时借用后续毫秒的时间戳继续生成，不在持锁时等待时钟。
+const maxDrift = 1000
+
+// ErrClockMovedBackwards 系统时钟回拨超过 maxDrift，暂时无法生成递增的ID
+var ErrClockMovedBackwards = errors.New("clock moved backwards, refusing to generate id")
+
+// epoch 时间戳起点（2024-01-01 00:00:00 UTC），单位毫秒
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+// Generator 雪花算法ID生成器，生成的ID随时间单调递增
+type Generator struct {
+	node     int64
+	lastTime int64 // 最近一个ID的逻辑时间戳，可能领先系统时钟
+	lastWall int64 // 观察到的最大系统时间戳，用于识别时钟回拨
+	sequence int64
+	now      func() time.Time
+	mutex    sync.Mutex
+}
+
+// NewGenerator 创建ID生成器，node 取值范围 [0, 15]
+func NewGenerator(node int64) (*Generator, error) {
+	if node < 0 || node > maxNode {
+		return nil, fmt.Errorf("node id must be between 0 and %d", maxNode)
+	}
+	return &Generator{node: node, now: time.Now}, nil
+}
+
+// Next 生成下一个ID
+// 时钟回拨时沿用上次的时间戳，序列号用尽时借用下一毫秒；回拨超过 maxDrift 时返回 ErrClockMovedBackwards，
+// 生成过快导致逻辑时间戳领先 maxDrift 时在锁外等待系统时钟追上。
+func (g *Generator) Next() (uint64, error) {
+	for {
+		id, ok, err := g.next()
+		if ok || err != nil {
+			return id, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// next 尝试生成下一个ID，逻辑时间戳需要等待系统时钟时返回 ok 为 false
+func (g *Generator) next() (uint64, bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := g.now().UnixMilli() - epoch
+	if now < g.lastWall-maxDrift {
+		return 0, false, ErrClockMovedBackwards
+	}
+	g.lastWall = max(g.lastWall, now)
+
+	if now > g.lastTime {
+		g.lastTime = now
+		g.sequence = 0
+		return g.id(), true, nil
+	}
+
+	if g.sequence == maxSequence {
+		if g.lastTime-now >= maxDrift {
+			return 0, false, nil
+		}
+		g.lastTime++
+		g.sequence = 0
+		return g.id(), true, nil
+	}
+	g.sequence++
+	return g.id(), true, nil
+}
+
+func (g *Generator) id() uint64 {
+	return uint64(g.lastTime<<timeShift | g.node<<nodeShift | g.sequence)
+}
+
+var defaultGenerator, _ = NewGenerator(0)
+
+// Init 设置全局生成器的节点ID
+func Init(node int64) error {
+	g, err := NewGenerator(node)
+	if err != nil {
+		return err
+	}
+	defaultGenerator = g
+	return nil
+}
+
+// NextID 使用全局生成器生成下一个ID
+func NextID() (uint64, error) {
+	return defaultGenerator.Next()
+}
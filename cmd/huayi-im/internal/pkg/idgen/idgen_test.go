@@ -0,0 +1,79 @@
+package idgen
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock 可手动拨动的时钟
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestGenerator(t *testing.T, clock *fakeClock) *Generator {
+	t.Helper()
+	g, err := NewGenerator(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.now = clock.now
+	return g
+}
+
+func TestNextMonotonicAcrossSequenceExhaustion(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	g := newTestGenerator(t, clock)
+
+	var last uint64
+	// 时钟静止时序列号用尽后借用后续毫秒，不等待
+	for i := 0; i < 10*(maxSequence+1); i++ {
+		id, err := g.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d: %v", i, err)
+		}
+		if id <= last {
+			t.Fatalf("Next() #%d = %d, not greater than %d", i, id, last)
+		}
+		last = id
+	}
+	if lead := g.lastTime - (clock.t.UnixMilli() - epoch); lead != 9 {
+		t.Fatalf("lead = %dms, want 9ms", lead)
+	}
+}
+
+func TestNextClockRollback(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	g := newTestGenerator(t, clock)
+
+	first, err := g.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 回拨不超过 maxDrift 时沿用上次的时间戳
+	clock.t = clock.t.Add(-500 * time.Millisecond)
+	second, err := g.Next()
+	if err != nil {
+		t.Fatalf("Next() after small rollback: %v", err)
+	}
+	if second <= first {
+		t.Fatalf("Next() after small rollback = %d, not greater than %d", second, first)
+	}
+
+	// 回拨超过 maxDrift 时返回错误而不是阻塞
+	clock.t = clock.t.Add(-2 * time.Second)
+	if _, err := g.Next(); !errors.Is(err, ErrClockMovedBackwards) {
+		t.Fatalf("Next() after large rollback: err = %v, want ErrClockMovedBackwards", err)
+	}
+
+	// 时钟恢复后继续生成递增的ID
+	clock.t = clock.t.Add(3 * time.Second)
+	third, err := g.Next()
+	if err != nil {
+		t.Fatalf("Next() after recovery: %v", err)
+	}
+	if third <= second {
+		t.Fatalf("Next() after recovery = %d, not greater than %d", third, second)
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/errno"
+)
+
+// AdminMiddleware 管理接口鉴权中间件，需在 TokenMiddleware 之后使用
+// 登录只需用户名，管理员用户名可被任何人占用，因此还需在 X-Admin-Token 头中携带配置的管理令牌；未配置令牌时拒绝所有请求。
+func AdminMiddleware(cfg config.AdminConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, exists := c.Get("username")
+		if !exists {
+			response.AbortError(c, errno.Unauthorized.WithMsg("missing username"))
+			return
+		}
+
+		if cfg.Username == "" || username.(string) != cfg.Username {
+			response.AbortError(c, errno.Forbidden)
+			return
+		}
+
+		token := c.GetHeader("X-Admin-Token")
+		if cfg.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+			response.AbortError(c, errno.Forbidden.WithMsg("invalid admin token"))
+			return
+		}
+		c.Next()
+	}
+}
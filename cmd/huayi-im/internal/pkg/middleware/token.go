@@ -3,6 +3,7 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/pkg/errno"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/service"
 )
@@ -31,7 +32,11 @@ func TokenMiddleware(userService service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		// 4. 设置用户名到上下文
+		// 4. 任何请求都视为客户端活跃，同时为同一会话的 WebSocket 连接保活
+		manager.ActivityTracker.Touch(username)
+		manager.MessageManager.TouchSession(username, sessionID)
+
+		// 5. 设置用户名到上下文
 		c.Set("username", username)
 		c.Next()
 	}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Index 内存倒排索引：词项 -> 包含该词项的文档ID（升序）
+// 文档ID随时间递增（如雪花算法ID），新文档基本都追加在倒排列表末尾。
+// 每个文档属于一个范围（如会话），查询时先按范围过滤再排序分页。
+type Index struct {
+	postings map[string][]uint64
+	scopes   map[uint64]string // 文档ID -> 范围
+	mutex    sync.RWMutex
+}
+
+// NewIndex 创建倒排索引
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string][]uint64),
+		scopes:   make(map[uint64]string),
+	}
+}
+
+// Add 索引 scope 范围内的文档，重复添加同一文档不会产生重复记录
+func (idx *Index) Add(id uint64, scope, text string) {
+	terms := indexTerms(text)
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.scopes[id] = scope
+	for _, term := range terms {
+		list := idx.postings[term]
+		i, found := slices.BinarySearch(list, id)
+		if found {
+			continue
+		}
+		idx.postings[term] = slices.Insert(list, i, id)
+	}
+}
+
+// Remove 从索引中删除文档，text 为索引时的文本
+func (idx *Index) Remove(id uint64, text string) {
+	terms := indexTerms(text)
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	delete(idx.scopes, id)
+	for _, term := range terms {
+		list := idx.postings[term]
+		i, found := slices.BinarySearch(list, id)
+		if !found {
+			continue
+		}
+		if len(list) == 1 {
+			delete(idx.postings, term)
+			continue
+		}
+		idx.postings[term] = slices.Delete(list, i, i+1)
+	}
+}
+
+// Search 查找包含查询中所有词项、且范围被 allow 接受的文档，按文档ID降序（由新到旧）返回ID小于 before（为 0 时不限）的结果
+// 中日韩文字按二元组匹配，结果可能包含词序不同的文档，由调用方用 Matches 复核。
+func (idx *Index) Search(query string, before uint64, allow func(scope string) bool) []uint64 {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	lists := make([][]uint64, 0, len(terms))
+	for _, term := range terms {
+		list, exists := idx.postings[term]
+		if !exists {
+			return nil
+		}
+		lists = append(lists, list)
+	}
+	// 从最短的倒排列表开始求交集
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	shortest := lists[0]
+	end := len(shortest)
+	if before > 0 {
+		end, _ = slices.BinarySearch(shortest, before)
+	}
+
+	ids := make([]uint64, 0, end)
+	for i := end - 1; i >= 0; i-- {
+		id := shortest[i]
+		if allow(idx.scopes[id]) && containsAll(lists[1:], id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// containsAll 判断文档ID是否出现在所有倒排列表中
+func containsAll(lists [][]uint64, id uint64) bool {
+	for _, list := range lists {
+		if _, found := slices.BinarySearch(list, id); !found {
+			return false
+		}
+	}
+	return true
+}
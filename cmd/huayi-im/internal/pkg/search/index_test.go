@@ -0,0 +1,94 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func allowAll(string) bool { return true }
+
+func TestIndexSearchAllTerms(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(1, "topic:go", "deploy failed on prod")
+	idx.Add(2, "topic:go", "deploy succeeded")
+	idx.Add(3, "topic:go", "prod deploy failed again")
+	// 重复添加不产生重复结果
+	idx.Add(3, "topic:go", "prod deploy failed again")
+
+	if got, want := idx.Search("Deploy failed", 0, allowAll), []uint64{3, 1}; !slices.Equal(got, want) {
+		t.Fatalf("Search = %v, want %v", got, want)
+	}
+	if got := idx.Search("deploy missing", 0, allowAll); len(got) != 0 {
+		t.Fatalf("Search with unknown term = %v, want none", got)
+	}
+	if got := idx.Search("...", 0, allowAll); got != nil {
+		t.Fatalf("Search without terms = %v, want nil", got)
+	}
+}
+
+func TestIndexSearchCJK(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(1, "topic:cn", "我在北京大学读书")
+	idx.Add(2, "topic:cn", "东京大学和北京")
+	idx.Add(3, "topic:cn", "上海")
+
+	// 二元组都出现但不相连的文档也会命中，由 Matches 复核排除
+	texts := map[uint64]string{1: "我在北京大学读书", 2: "东京大学和北京"}
+	got := idx.Search("北京大学", 0, allowAll)
+	if want := []uint64{2, 1}; !slices.Equal(got, want) {
+		t.Fatalf("Search(北京大学) = %v, want %v", got, want)
+	}
+	got = slices.DeleteFunc(got, func(id uint64) bool { return !Matches(texts[id], "北京大学") })
+	if want := []uint64{1}; !slices.Equal(got, want) {
+		t.Fatalf("Search(北京大学) after Matches = %v, want %v", got, want)
+	}
+	if got, want := idx.Search("北京", 0, allowAll), []uint64{2, 1}; !slices.Equal(got, want) {
+		t.Fatalf("Search(北京) = %v, want %v", got, want)
+	}
+	// 单字查询命中索引中的单字
+	if got, want := idx.Search("海", 0, allowAll), []uint64{3}; !slices.Equal(got, want) {
+		t.Fatalf("Search(海) = %v, want %v", got, want)
+	}
+}
+
+func TestIndexSearchBefore(t *testing.T) {
+	idx := NewIndex()
+	for id := uint64(1); id <= 5; id++ {
+		idx.Add(id, "topic:go", "hello")
+	}
+	if got, want := idx.Search("hello", 4, allowAll), []uint64{3, 2, 1}; !slices.Equal(got, want) {
+		t.Fatalf("Search before 4 = %v, want %v", got, want)
+	}
+	if got := idx.Search("hello", 1, allowAll); len(got) != 0 {
+		t.Fatalf("Search before 1 = %v, want none", got)
+	}
+}
+
+func TestIndexSearchScope(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(1, "topic:public", "hello")
+	idx.Add(2, "p2p:alice,bob", "hello")
+	idx.Add(3, "p2p:carol,dave", "hello")
+
+	allow := func(scope string) bool { return scope != "p2p:carol,dave" }
+	if got, want := idx.Search("hello", 0, allow), []uint64{2, 1}; !slices.Equal(got, want) {
+		t.Fatalf("Search = %v, want %v", got, want)
+	}
+}
+
+func TestIndexRemove(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(1, "topic:go", "hello world")
+	idx.Add(2, "topic:go", "hello")
+	idx.Remove(1, "hello world")
+
+	if got, want := idx.Search("hello", 0, allowAll), []uint64{2}; !slices.Equal(got, want) {
+		t.Fatalf("Search after Remove = %v, want %v", got, want)
+	}
+	if _, exists := idx.postings["world"]; exists {
+		t.Fatal("empty posting list for \"world\" not deleted")
+	}
+	if _, exists := idx.scopes[1]; exists {
+		t.Fatal("scope of removed document not deleted")
+	}
+}
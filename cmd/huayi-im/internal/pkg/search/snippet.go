@@ -0,0 +1,74 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// 摘要中命中词的高亮标记
+const (
+	HighlightPre  = "<mark>"
+	HighlightPost = "</mark>"
+)
+
+const ellipsis = "…"
+
+// Snippet 截取原文中第一个命中词附近最多 width 个字符作为摘要，命中词以 <mark></mark> 包裹
+// 摘要是 HTML 片段：原文经过转义，只有高亮标记是 HTML 标签。
+func Snippet(text, query string, width int) string {
+	wanted := make(map[string]bool)
+	for _, term := range Terms(query) {
+		wanted[term] = true
+	}
+
+	// 命中区间，相邻或重叠的区间（如连续的二元组）合并为一段
+	var spans [][2]int
+	for _, t := range tokenize(text, true) {
+		if !wanted[t.term] {
+			continue
+		}
+		if n := len(spans); n > 0 && t.start <= spans[n-1][1] {
+			spans[n-1][1] = max(spans[n-1][1], t.end)
+			continue
+		}
+		spans = append(spans, [2]int{t.start, t.end})
+	}
+
+	// 窗口从第一个命中词前四分之一宽度处开始
+	start := 0
+	if len(spans) > 0 {
+		start = spans[0][0]
+		for back := 0; back < width/4 && start > 0; back++ {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+		}
+	}
+	end := start
+	for n := 0; n < width && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(ellipsis)
+	}
+	pos := start
+	for _, span := range spans {
+		from, to := max(span[0], start), min(span[1], end)
+		if from >= to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:from]))
+		b.WriteString(HighlightPre)
+		b.WriteString(html.EscapeString(text[from:to]))
+		b.WriteString(HighlightPost)
+		pos = to
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString(ellipsis)
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token 分词结果，start/end 为词在原文中的字节区间
+type token struct {
+	term  string
+	start int
+	end   int
+}
+
+// isCJK 判断是否为中日韩文字；这类文字没有空格分词，按相邻两字切分
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// isWord 判断是否为拉丁等以空格分词的文字中的词字符
+func isWord(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsNumber(r)) && !isCJK(r)
+}
+
+// tokenize 分词：拉丁文字按非字母数字切分并转为小写；连续的中日韩文字切分为二元组（bigram），
+// 只有一个字时保留单字。unigrams 为 true 时额外输出每个中日韩单字，用于索引以支持单字查询。
+func tokenize(text string, unigrams bool) []token {
+	var tokens []token
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case isWord(r):
+			start := i
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !isWord(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+		case isCJK(r):
+			var offsets []int
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !isCJK(r) {
+					break
+				}
+				offsets = append(offsets, i)
+				i += size
+			}
+			offsets = append(offsets, i)
+			tokens = appendCJK(tokens, text, offsets, unigrams)
+		default:
+			i += size
+		}
+	}
+	return tokens
+}
+
+// appendCJK 切分一段连续的中日韩文字，offsets 为每个字的起始字节位置加上结尾位置
+func appendCJK(tokens []token, text string, offsets []int, unigrams bool) []token {
+	chars := len(offsets) - 1
+	for k := 0; k < chars; k++ {
+		if unigrams || chars == 1 {
+			tokens = append(tokens, token{term: text[offsets[k]:offsets[k+1]], start: offsets[k], end: offsets[k+1]})
+		}
+		if k+2 <= chars {
+			tokens = append(tokens, token{term: text[offsets[k]:offsets[k+2]], start: offsets[k], end: offsets[k+2]})
+		}
+	}
+	return tokens
+}
+
+// Terms 查询词项：拉丁词与中日韩二元组（单字查询时为单字），去重后保持原有顺序
+func Terms(query string) []string {
+	return uniqueTerms(tokenize(query, false))
+}
+
+// indexTerms 索引词项：在查询词项的基础上包含所有中日韩单字
+func indexTerms(text string) []string {
+	return uniqueTerms(tokenize(text, true))
+}
+
+// uniqueTerms 提取去重后的词项
+func uniqueTerms(tokens []token) []string {
+	terms := make([]string, 0, len(tokens))
+	seen := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+	return terms
+}
+
+// phrases 查询中连续的拉丁词字符或中日韩文字片段，拉丁片段转为小写
+func phrases(query string) []string {
+	var result []string
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		in := isWord
+		if isCJK(r) {
+			in = isCJK
+		} else if !isWord(r) {
+			i += size
+			continue
+		}
+
+		start := i
+		for i < len(query) {
+			r, size := utf8.DecodeRuneInString(query[i:])
+			if !in(r) {
+				break
+			}
+			i += size
+		}
+		result = append(result, strings.ToLower(query[start:i]))
+	}
+	return result
+}
+
+// Matches 复核文本是否包含查询中的每个片段（不区分大小写的子串匹配）
+// 用于排除中日韩二元组词序不同造成的误命中，如查询“北京大学”命中“大学在北京”。
+func Matches(text, query string) bool {
+	lower := strings.ToLower(text)
+	for _, phrase := range phrases(query) {
+		if !strings.Contains(lower, phrase) {
+			return false
+		}
+	}
+	return true
+}
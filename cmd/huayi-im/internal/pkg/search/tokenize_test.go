@@ -0,0 +1,74 @@
+package search
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		// 拉丁文字按非字母数字切分并转为小写，去重后保持顺序
+		{"Hello, WORLD hello", []string{"hello", "world"}},
+		{"v2 release-notes", []string{"v2", "release", "notes"}},
+		// 连续的中日韩文字切分为二元组
+		{"北京大学", []string{"北京", "京大", "大学"}},
+		// 只有一个字时保留单字
+		{"北", []string{"北"}},
+		// 拉丁与中日韩混排时分别切分
+		{"Go语言abc", []string{"go", "语言", "abc"}},
+		{"  ,.!", []string{}},
+	}
+	for _, c := range cases {
+		if got := Terms(c.query); !slices.Equal(got, c.want) {
+			t.Fatalf("Terms(%q) = %q, want %q", c.query, got, c.want)
+		}
+	}
+}
+
+func TestIndexTermsIncludeUnigrams(t *testing.T) {
+	got := indexTerms("北京大")
+	want := []string{"北", "北京", "京", "京大", "大"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("indexTerms = %q, want %q", got, want)
+	}
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	text := "Hi 北京大"
+	for _, tok := range tokenize(text, true) {
+		if got := strings.ToLower(text[tok.start:tok.end]); got != tok.term {
+			t.Fatalf("token %q spans %q", tok.term, got)
+		}
+	}
+}
+
+func TestPhrases(t *testing.T) {
+	got := phrases("Hello 北京大学, World!")
+	want := []string{"hello", "北京大学", "world"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("phrases = %q, want %q", got, want)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	cases := []struct {
+		text, query string
+		want        bool
+	}{
+		{"我在北京大学读书", "北京大学", true},
+		// 二元组都命中但词序不同
+		{"大学在北京", "北京大学", false},
+		{"Deploy FAILED on prod", "failed prod", true},
+		{"Deploy failed", "failed prod", false},
+		{"anything", "", true},
+	}
+	for _, c := range cases {
+		if got := Matches(c.text, c.query); got != c.want {
+			t.Fatalf("Matches(%q, %q) = %v, want %v", c.text, c.query, got, c.want)
+		}
+	}
+}
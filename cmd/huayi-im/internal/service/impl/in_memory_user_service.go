@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/api/response"
+	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/config"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/manager"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/model"
 	"github.com/qmrp/go-homework-s3/cmd/huayi-im/internal/service"
@@ -14,16 +15,32 @@ import (
 
 // InMemoryUserService 基于内存的用户服务实现
 type InMemoryUserService struct {
-	users    map[string]*model.User
-	sessions map[string]string
-	mutex    sync.RWMutex
+	users         map[string]*model.User
+	sessions      map[string]string         // session ID -> username
+	userSessions  map[string][]string       // username -> session ID 列表，按登录先后排序
+	published     map[string]presenceRecord // username -> 最近一次发布的在线状态
+	sessionConfig config.SessionConfig
+	idleAfter     time.Duration
+	mutex         sync.RWMutex
+	publishMutex  sync.Mutex // 串行扇出 presence 事件，不占用用户锁
+	version       uint64     // 最近一次记录的 presence 事件版本号，受 mutex 保护
+}
+
+// presenceRecord 记录的在线状态及其版本号，用户锁内记录、释放锁后扇出
+type presenceRecord struct {
+	event   model.PresenceEvent
+	version uint64
 }
 
 // NewInMemoryUserService 创建基于内存的用户服务实例
-func NewInMemoryUserService() service.UserService {
+func NewInMemoryUserService(sessionConfig config.SessionConfig, presenceConfig config.PresenceConfig) service.UserService {
 	return &InMemoryUserService{
-		users:    make(map[string]*model.User),
-		sessions: make(map[string]string),
+		users:         make(map[string]*model.User),
+		sessions:      make(map[string]string),
+		userSessions:  make(map[string][]string),
+		published:     make(map[string]presenceRecord),
+		sessionConfig: sessionConfig,
+		idleAfter:     presenceConfig.IdleAfter,
 	}
 }
 
@@ -66,7 +83,6 @@ func (s *InMemoryUserService) ExistsByUsername(ctx context.Context, username str
 // Login 登录
 func (s *InMemoryUserService) Login(ctx context.Context, username string) (string, error) {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 
 	// 查找用户
 	user, exists := s.users[username]
@@ -87,62 +103,232 @@ func (s *InMemoryUserService) Login(ctx context.Context, username string) (strin
 	// 生成session ID
 	sessionID := fmt.Sprintf("%s_%d", username, time.Now().UnixNano())
 
-	// 保存session
+	// 保存session，并按会话策略淘汰旧会话
 	s.sessions[sessionID] = username
-	for sid, user := range s.sessions {
-		if user == username {
-			println(sid, user)
-		}
+	s.userSessions[username] = append(s.userSessions[username], sessionID)
+	revoked, reason := s.revokeSessionsLocked(username)
+
+	// 设置用户在线状态，登录本身也是一次活动
+	manager.ActivityTracker.Touch(username)
+	change := s.setOnlineLocked(user, true)
+	s.mutex.Unlock()
+	s.publishPresence(change)
+
+	// 被淘汰会话的 WebSocket 连接收到 kicked 消息后断开
+	for _, sid := range revoked {
+		manager.MessageManager.KickSession(username, sid, reason)
 	}
 
-	// 设置用户在线状态
-	user.Online = true
-	user.UpdatedAt = time.Now()
-
 	return sessionID, nil
 }
 
+// revokeSessionsLocked 按会话策略淘汰用户的旧会话，返回被淘汰的 session ID 及原因，调用方需持有写锁
+func (s *InMemoryUserService) revokeSessionsLocked(username string) ([]string, string) {
+	sessionIDs := s.userSessions[username]
+
+	keep := len(sessionIDs)
+	reason := ""
+	switch {
+	case s.sessionConfig.Policy == config.SessionPolicySingle:
+		keep = 1
+		reason = "logged in elsewhere"
+	case s.sessionConfig.MaxSessions > 0 && keep > s.sessionConfig.MaxSessions:
+		keep = s.sessionConfig.MaxSessions
+		reason = "session limit exceeded"
+	}
+	if keep >= len(sessionIDs) {
+		return nil, ""
+	}
+
+	revoked := sessionIDs[:len(sessionIDs)-keep]
+	for _, sid := range revoked {
+		delete(s.sessions, sid)
+	}
+	s.userSessions[username] = append([]string(nil), sessionIDs[len(sessionIDs)-keep:]...)
+	return revoked, reason
+}
+
 // Logout 登出
 func (s *InMemoryUserService) Logout(ctx context.Context, username string) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 
 	// 查找用户
 	user, exists := s.users[username]
 	if !exists {
+		s.mutex.Unlock()
 		return nil // 用户不存在，忽略
 	}
 
 	// 设置用户离线状态
-	user.Online = false
-	user.UpdatedAt = time.Now()
+	change := s.setOnlineLocked(user, false)
 
 	// 清除所有该用户的session
-	for sessionID, user := range s.sessions {
-		if user == username {
-			delete(s.sessions, sessionID)
-		}
+	for _, sessionID := range s.userSessions[username] {
+		delete(s.sessions, sessionID)
 	}
-	manager.MessageManager.UnregisterConnection(username)
+	delete(s.userSessions, username)
+	s.mutex.Unlock()
+
+	// 关闭连接时未送达的消息会转存离线（可能写磁盘），在用户锁外进行，避免阻塞其他用户登录登出
+	manager.MessageManager.UnregisterUser(username)
+	s.publishPresence(change)
 	return nil
 }
 
 // SetOnlineStatus 设置用户在线状态
 func (s *InMemoryUserService) SetOnlineStatus(ctx context.Context, username string, online bool) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 
 	// 查找用户
 	user, exists := s.users[username]
 	if !exists {
+		s.mutex.Unlock()
 		return fmt.Errorf("user not found")
 	}
 
 	// 设置在线状态
+	change := s.setOnlineLocked(user, online)
+	s.mutex.Unlock()
+
+	s.publishPresence(change)
+	return nil
+}
+
+// setOnlineLocked 更新在线状态，状态变化时记录 presence 事件并返回，调用方需持有写锁，释放锁后调用 publishPresence
+func (s *InMemoryUserService) setOnlineLocked(user *model.User, online bool) *presenceRecord {
+	now := time.Now()
+	changed := user.Online != online
 	user.Online = online
+	user.UpdatedAt = now
+	if !changed {
+		return nil
+	}
+
+	if !online {
+		// 最后在线时间取最后一次活动时间，心跳判定离线时早于当前时间
+		lastSeen := now
+		if lastActive, exists := manager.ActivityTracker.LastActive(user.Username); exists {
+			lastSeen = lastActive
+		}
+		user.LastSeenAt = &lastSeen
+	}
+	return s.recordPresenceLocked(user)
+}
+
+// presence 推导用户当前的在线状态
+func (s *InMemoryUserService) presence(user *model.User) model.PresenceEvent {
+	lastActive, _ := manager.ActivityTracker.LastActive(user.Username)
+	return model.ResolvePresence(user, lastActive, s.idleAfter, time.Now())
+}
+
+// presenceChanged 当前状态是否与上次记录的不同，调用方需持有读锁或写锁
+func (s *InMemoryUserService) presenceChanged(user *model.User, event model.PresenceEvent) bool {
+	last, exists := s.published[user.Username]
+	return !exists || last.event.Status != event.Status || last.event.StatusText != event.StatusText
+}
+
+// recordPresenceLocked 状态与上次记录的不同时记录为最新状态，返回待发布的事件，没有变化时返回 nil
+// 调用方需持有写锁，并在释放锁后调用 publishPresence，避免在用户锁内向所有相关用户扇出。
+func (s *InMemoryUserService) recordPresenceLocked(user *model.User) *presenceRecord {
+	event := s.presence(user)
+	if !s.presenceChanged(user, event) {
+		return nil
+	}
+	s.version++
+	record := presenceRecord{event: event, version: s.version}
+	s.published[user.Username] = record
+	return &record
+}
+
+// publishPresence 扇出记录的 presence 事件，change 为 nil 时忽略
+// 发布串行进行，且只发布仍是该用户最新记录的事件，保证较早的状态不会在较新的状态之后下发。
+func (s *InMemoryUserService) publishPresence(change *presenceRecord) {
+	if change == nil {
+		return
+	}
+
+	s.publishMutex.Lock()
+	defer s.publishMutex.Unlock()
+
+	s.mutex.RLock()
+	latest := s.published[change.event.Username].version == change.version
+	s.mutex.RUnlock()
+	if latest {
+		manager.MessageManager.PublishPresence(change.event)
+	}
+}
+
+// GetPresence 获取用户当前的在线状态
+func (s *InMemoryUserService) GetPresence(ctx context.Context, username string) (model.PresenceEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return model.PresenceEvent{}, fmt.Errorf("user not found")
+	}
+	return s.presence(user), nil
+}
+
+// SetPresence 手动设置在线状态与自定义状态文本
+func (s *InMemoryUserService) SetPresence(ctx context.Context, username, status, statusText string) (model.PresenceEvent, error) {
+	manual, err := model.ManualPresence(status)
+	if err != nil {
+		return model.PresenceEvent{}, err
+	}
+
+	s.mutex.Lock()
+	user, exists := s.users[username]
+	if !exists {
+		s.mutex.Unlock()
+		return model.PresenceEvent{}, fmt.Errorf("user not found")
+	}
+	user.ManualStatus = manual
+	user.StatusText = statusText
 	user.UpdatedAt = time.Now()
+	change := s.recordPresenceLocked(user)
+	current := s.presence(user)
+	s.mutex.Unlock()
 
-	return nil
+	s.publishPresence(change)
+	return current, nil
+}
+
+// RefreshPresence 重新推导在线状态，由心跳周期调用以发布 idle 等随时间变化的状态
+// 每个连接每个心跳周期都会调用，状态未变化时只持有读锁。
+func (s *InMemoryUserService) RefreshPresence(ctx context.Context, username string) {
+	s.mutex.RLock()
+	user, exists := s.users[username]
+	changed := exists && s.presenceChanged(user, s.presence(user))
+	s.mutex.RUnlock()
+	if !changed {
+		return
+	}
+
+	s.mutex.Lock()
+	change := s.recordPresenceLocked(user)
+	s.mutex.Unlock()
+	s.publishPresence(change)
+}
+
+// GetUserProfile 获取用户详情及当前在线状态
+func (s *InMemoryUserService) GetUserProfile(ctx context.Context, username string) (response.UserProfileResponse, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return response.UserProfileResponse{}, fmt.Errorf("user not found")
+	}
+
+	snapshot := *user
+	item := s.userResponse(user)
+	return response.UserProfileResponse{
+		User:         &snapshot,
+		Presence:     item.Presence,
+		StatusText:   item.StatusText,
+		LastActiveAt: item.LastActiveAt,
+	}, nil
 }
 
 // GetOnlineUsers 获取所有在线用户
@@ -151,9 +337,9 @@ func (s *InMemoryUserService) GetOnlineUsers(ctx context.Context) (response.User
 	defer s.mutex.RUnlock()
 
 	var onlineUsers []response.UserResponse
-	for username, user := range s.users {
+	for _, user := range s.users {
 		if user.Online {
-			onlineUsers = append(onlineUsers, response.UserResponse{Username: username})
+			onlineUsers = append(onlineUsers, s.userResponse(user))
 		}
 	}
 
@@ -168,8 +354,8 @@ func (s *InMemoryUserService) GetAllUsers(ctx context.Context) (response.UserLis
 	defer s.mutex.RUnlock()
 
 	var allUsers []response.UserResponse
-	for username := range s.users {
-		allUsers = append(allUsers, response.UserResponse{Username: username})
+	for _, user := range s.users {
+		allUsers = append(allUsers, s.userResponse(user))
 	}
 
 	return response.UserListResponse{
@@ -178,6 +364,21 @@ func (s *InMemoryUserService) GetAllUsers(ctx context.Context) (response.UserLis
 	}, nil
 }
 
+// userResponse 用户列表项，附带在线状态、最后活动与最后在线时间
+func (s *InMemoryUserService) userResponse(user *model.User) response.UserResponse {
+	presence := s.presence(user)
+	resp := response.UserResponse{
+		Username:   user.Username,
+		Presence:   presence.Status,
+		StatusText: presence.StatusText,
+		LastSeenAt: user.LastSeenAt,
+	}
+	if lastActive, exists := manager.ActivityTracker.LastActive(user.Username); exists {
+		resp.LastActiveAt = &lastActive
+	}
+	return resp
+}
+
 func (s *InMemoryUserService) GetUsernameBySessionID(sessionID string) (string, bool) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -20,4 +20,8 @@ type UserService interface {
 	GetUsernameBySessionID(sessionID string) (string, bool)
 	SetNonResponseCount(ctx context.Context, username string, count int) error
 	SetLastAckId(ctx context.Context, username string, ackID int64) error
+	GetUserProfile(ctx context.Context, username string) (response.UserProfileResponse, error)
+	GetPresence(ctx context.Context, username string) (model.PresenceEvent, error)
+	SetPresence(ctx context.Context, username, status, statusText string) (model.PresenceEvent, error) // 手动设置 away/dnd，online 恢复自动推导
+	RefreshPresence(ctx context.Context, username string)                                              // 重新推导状态（如 idle），变化时发布 presence 事件
 }
@@ -221,7 +221,7 @@ var _ = Describe("WebSocket E2E Tests", Ordered, func() {
 			Expect(err).NotTo(HaveOccurred(), "查询用户列表失败")
 			Expect(users.Total).To(Equal(11))
 			// 检查列表是否包含 test-topic
-			Expect(users.List).To(ContainElement(response.UserResponse{Username: "zhou"}))
+			Expect(users.List).To(ContainElement(HaveField("Username", "zhou")))
 		})
 		It("最后登出用户", func() {
 			err := userClient.Logout()
@@ -21,7 +21,7 @@ export function ChatShell() {
                 <span className="inline-flex items-center gap-1">
                   {state.ws === 'connected' ? (
                     <>
-                      <Wifi className="h-3.5 w-3.5" /> online
+                      <Wifi className="h-3.5 w-3.5" /> {state.synced ? 'online' : 'syncing…'}
                     </>
                   ) : (
                     <>
@@ -8,6 +8,15 @@ import { Input } from '@/components/ui/input'
 import { ScrollArea } from '@/components/ui/scroll-area'
 import { cn } from '@/lib/utils'
 import { useIm } from '@/im/context'
+import type { PresenceStatus } from '@/im/types'
+
+const PRESENCE_DOT: Record<PresenceStatus, string> = {
+  online: 'bg-emerald-500',
+  idle: 'bg-amber-400',
+  away: 'bg-amber-400',
+  dnd: 'bg-red-500',
+  offline: 'bg-muted-foreground/40',
+}
 
 export function ChatSidebar() {
   const { state, select } = useIm()
@@ -56,6 +65,15 @@ export function ChatSidebar() {
                 <div className="min-w-0 flex-1 text-left">
                   <div className="flex items-center gap-2">
                     <div className="truncate text-sm font-medium">{conv.title}</div>
+                    {conv.kind === 'p2p' && state.presence[conv.id] ? (
+                      <span
+                        className={cn(
+                          'h-2 w-2 shrink-0 rounded-full',
+                          PRESENCE_DOT[state.presence[conv.id]],
+                        )}
+                        title={state.presence[conv.id]}
+                      />
+                    ) : null}
                     {conv.unread > 0 ? (
                       <Badge variant="secondary" className="ml-auto">
                         {conv.unread}
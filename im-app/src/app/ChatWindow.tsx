@@ -49,8 +49,15 @@ function EmptyConversation() {
 }
 
 function ActiveConversation() {
-  const { state, joinTopic, quitTopic, send, setDraftMentions, setDraftText } =
-    useIm();
+  const {
+    state,
+    joinTopic,
+    quitTopic,
+    send,
+    setDraftMentions,
+    setDraftText,
+    notifyTyping,
+  } = useIm();
   const key = state.selected!;
   const conv = state.conversations[key]!;
 
@@ -62,6 +69,7 @@ function ActiveConversation() {
 
   const draft = state.draftText[key] ?? "";
   const mentions = state.draftMentions[key] ?? "";
+  const typingUsers = state.typing[key] ?? [];
 
   const titleIcon = conv.kind === "topic" ? Hash : User;
 
@@ -139,7 +147,10 @@ function ActiveConversation() {
         <div className="flex items-end gap-2">
           <Textarea
             value={draft}
-            onChange={(e) => setDraftText(key, e.target.value)}
+            onChange={(e) => {
+              setDraftText(key, e.target.value);
+              if (e.target.value) notifyTyping(key);
+            }}
             placeholder="Type a message…"
             className="min-h-[44px] resize-none"
             onKeyDown={(e) => {
@@ -156,6 +167,11 @@ function ActiveConversation() {
             <Send />
           </Button>
         </div>
+        {typingUsers.length > 0 ? (
+          <div className="text-xs text-muted-foreground">
+            {typingUsers.join(", ")} 正在输入…
+          </div>
+        ) : null}
         <div className="text-xs text-muted-foreground">
           Enter 发送，Shift+Enter 换行。
         </div>
@@ -171,10 +187,23 @@ function MessageRow({
   convKind: "p2p" | "topic";
   msg: ChatMessage;
 }) {
+  const { react } = useIm();
   const isOut = msg.direction === "out";
   const name = isOut ? "You" : msg.from;
+  // 只有带服务端 ID 的消息可以回应
+  const canReact = !msg.recalled && /^\d+$/.test(msg.id);
   const showFrom = convKind === "topic" && !isOut;
 
+  if (msg.direction === "system") {
+    return (
+      <div className="flex justify-center">
+        <div className="rounded-full bg-muted px-3 py-1 text-xs text-muted-foreground">
+          {msg.content}
+        </div>
+      </div>
+    );
+  }
+
   return (
     <div className={cn("flex", isOut ? "justify-end" : "justify-start")}>
       <div
@@ -195,7 +224,11 @@ function MessageRow({
             {name}
           </div>
         ) : null}
-        <div className="whitespace-pre-wrap break-words">{msg.content}</div>
+        {msg.recalled ? (
+          <div className="italic opacity-70">message recalled</div>
+        ) : (
+          <div className="whitespace-pre-wrap break-words">{msg.content}</div>
+        )}
         <div
           className={cn(
             "mt-1 text-[10px]",
@@ -203,7 +236,36 @@ function MessageRow({
           )}
         >
           {fmtTime(msg.at)}
+          {msg.edited && !msg.recalled ? " · edited" : null}
+          {msg.threadRoot ? " · in thread" : null}
+          {msg.replyCount ? ` · ${msg.replyCount} replies` : null}
         </div>
+        {canReact ? (
+          <div className="mt-1 flex flex-wrap gap-1">
+            {(msg.reactions ?? []).map((r) => (
+              <button
+                key={r.emoji}
+                type="button"
+                className={cn(
+                  "rounded-full border px-1.5 text-xs",
+                  r.reacted ? "border-primary bg-primary/10" : "border-border",
+                )}
+                onClick={() => react(msg.id, r.emoji)}
+              >
+                {r.emoji} {r.count}
+              </button>
+            ))}
+            {msg.reactions?.some((r) => r.emoji === "👍") ? null : (
+              <button
+                type="button"
+                className="rounded-full border border-dashed px-1.5 text-xs opacity-60 hover:opacity-100"
+                onClick={() => react(msg.id, "👍")}
+              >
+                +👍
+              </button>
+            )}
+          </div>
+        ) : null}
       </div>
     </div>
   );
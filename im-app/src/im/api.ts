@@ -1,4 +1,4 @@
-import type { ConversationKind } from "@/im/types";
+import type { ConversationKind, Presence } from "@/im/types";
 
 export type ApiError = {
   status: number;
@@ -81,6 +81,22 @@ export async function apiUsers(online?: boolean): Promise<string[]> {
   return data.list.map((x) => x.username);
 }
 
+export async function apiSubscribePresence(
+  username: string,
+): Promise<Presence> {
+  const res = await request(
+    `/api/users/${encodeURIComponent(username)}/actions/subscribe`,
+    { method: "POST" },
+  );
+  if (!res.ok) {
+    throw {
+      status: res.status,
+      message: await readErrorMessage(res),
+    } satisfies ApiError;
+  }
+  return (await res.json()) as Presence;
+}
+
 export async function apiTopics(): Promise<string[]> {
   const res = await request("/api/topics");
   if (!res.ok) {
@@ -151,6 +167,7 @@ export async function apiSendMessage(params: {
   id: string;
   content: string;
   mentions?: string[];
+  clientMsgId: string;
 }): Promise<void> {
   const body =
     params.kind === "topic"
@@ -161,6 +178,7 @@ export async function apiSendMessage(params: {
           topic: params.id,
           "content-type": "text/plain",
           content: params.content,
+          "client-msg-id": params.clientMsgId,
         }
       : {
           "message-type": "message",
@@ -168,12 +186,16 @@ export async function apiSendMessage(params: {
           to: [params.id],
           "content-type": "text/plain",
           content: params.content,
+          "client-msg-id": params.clientMsgId,
         };
-  const res = await request("/api/messages", {
-    method: "POST",
-    headers: { "Content-Type": "application/json" },
-    body: JSON.stringify(body),
-  });
+  const post = () =>
+    request("/api/messages", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+    });
+  // 网络错误时以相同的 client-msg-id 重试一次，服务端不会重复投递
+  const res = await post().catch(() => post());
   if (!res.ok) {
     throw {
       status: res.status,
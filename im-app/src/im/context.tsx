@@ -15,6 +15,7 @@ import {
   apiLogout,
   apiQuitTopic,
   apiSendMessage,
+  apiSubscribePresence,
   apiTopics,
   apiUsers,
   getSID,
@@ -25,8 +26,10 @@ import type {
   Conversation,
   ConversationKey,
   ConversationKind,
+  MessageReaction,
+  PresenceStatus,
 } from "@/im/types";
-import { convKey, titleFor } from "@/im/types";
+import { PRESENCE_STATUSES, convKey, titleFor } from "@/im/types";
 import { wsURLWithSID } from "@/im/ws";
 
 type AuthState = "logged_out" | "logging_in" | "logged_in";
@@ -44,6 +47,15 @@ type State = {
 
   draftText: Record<ConversationKey, string>;
   draftMentions: Record<ConversationKey, string>;
+
+  // 会话中正在输入的用户
+  typing: Record<ConversationKey, string[]>;
+
+  // 用户在线状态，由 presence 消息实时更新
+  presence: Record<string, PresenceStatus>;
+
+  // 本次连接的离线消息是否已回放完毕（收到 sync-complete）
+  synced: boolean;
 };
 
 type Action =
@@ -52,6 +64,7 @@ type Action =
   | { type: "AUTH_LOGOUT" }
   | { type: "AUTH_ERR"; error: string }
   | { type: "WS_STATE"; ws: WSState }
+  | { type: "SYNC_COMPLETE" }
   | { type: "ERR"; error: string | null }
   | { type: "SELECT"; key: ConversationKey | null }
   | { type: "UPSERT_CONV"; kind: ConversationKind; id: string }
@@ -68,8 +81,24 @@ type Action =
       id: string;
       msg: ChatMessage;
     }
+  | {
+      type: "PATCH_MSG";
+      id: string;
+      content: string;
+      edited?: boolean;
+      recalled?: boolean;
+    }
+  | {
+      type: "REACTION";
+      id: string;
+      emoji: string;
+      count: number;
+      reacted?: boolean;
+    }
   | { type: "SET_DRAFT_TEXT"; key: ConversationKey; text: string }
-  | { type: "SET_DRAFT_MENTIONS"; key: ConversationKey; text: string };
+  | { type: "SET_DRAFT_MENTIONS"; key: ConversationKey; text: string }
+  | { type: "TYPING"; key: ConversationKey; from: string; typing: boolean }
+  | { type: "PRESENCE"; username: string; status: PresenceStatus };
 
 const initialState: State = {
   auth: "logged_out",
@@ -81,6 +110,9 @@ const initialState: State = {
   selected: null,
   draftText: {},
   draftMentions: {},
+  typing: {},
+  presence: {},
+  synced: false,
 };
 
 function ensureConversation(state: State, kind: ConversationKind, id: string) {
@@ -126,7 +158,13 @@ function reduce(state: State, action: Action): State {
     case "AUTH_ERR":
       return { ...state, auth: "logged_out", error: action.error };
     case "WS_STATE":
-      return { ...state, ws: action.ws };
+      return {
+        ...state,
+        ws: action.ws,
+        synced: action.ws === "connected" ? state.synced : false,
+      };
+    case "SYNC_COMPLETE":
+      return { ...state, synced: true };
     case "ERR":
       return { ...state, error: action.error };
     case "UPSERT_CONV": {
@@ -151,6 +189,8 @@ function reduce(state: State, action: Action): State {
     case "ADD_MSG": {
       const conv = state.conversations[action.key];
       if (!conv) return state;
+      // 重传的消息按服务端 ID 去重
+      if (conv.messages.some((m) => m.id === action.msg.id)) return state;
       const limit = 200;
       const nextMsgs = [...conv.messages, action.msg].slice(-limit);
       const nextConv: Conversation = {
@@ -174,7 +214,79 @@ function reduce(state: State, action: Action): State {
         action.id,
       );
       const unreadInc = next.selected !== key;
-      return reduce(next, { type: "ADD_MSG", key, msg: action.msg, unreadInc });
+      // 收到消息即清除发送者的输入提示
+      const cleared = reduce(next, {
+        type: "TYPING",
+        key,
+        from: action.msg.from,
+        typing: false,
+      });
+      return reduce(cleared, {
+        type: "ADD_MSG",
+        key,
+        msg: action.msg,
+        unreadInc,
+      });
+    }
+    case "PATCH_MSG": {
+      // 编辑与撤回事件只带消息 ID，在所有会话中查找
+      for (const key of state.order) {
+        const conv = state.conversations[key];
+        const idx = conv?.messages.findIndex((m) => m.id === action.id) ?? -1;
+        if (!conv || idx < 0) continue;
+        const msg = conv.messages[idx];
+        const nextMsgs = [...conv.messages];
+        nextMsgs[idx] = {
+          ...msg,
+          content: action.content,
+          edited: action.edited ?? msg.edited,
+          recalled: action.recalled ?? msg.recalled,
+        };
+        const nextConv: Conversation = {
+          ...conv,
+          messages: nextMsgs,
+          lastPreview:
+            idx === conv.messages.length - 1
+              ? action.content
+              : conv.lastPreview,
+        };
+        return {
+          ...state,
+          conversations: { ...state.conversations, [key]: nextConv },
+        };
+      }
+      return state;
+    }
+    case "REACTION": {
+      for (const key of state.order) {
+        const conv = state.conversations[key];
+        const idx = conv?.messages.findIndex((m) => m.id === action.id) ?? -1;
+        if (!conv || idx < 0) continue;
+        const msg = conv.messages[idx];
+        const current = msg.reactions ?? [];
+        const existing = current.find((r) => r.emoji === action.emoji);
+        const updated = {
+          emoji: action.emoji,
+          count: action.count,
+          reacted: action.reacted ?? existing?.reacted,
+        };
+        const reactions = existing
+          ? current.map((r) => (r.emoji === action.emoji ? updated : r))
+          : [...current, updated];
+        const nextMsgs = [...conv.messages];
+        nextMsgs[idx] = {
+          ...msg,
+          reactions: reactions.filter((r) => r.count > 0),
+        };
+        return {
+          ...state,
+          conversations: {
+            ...state.conversations,
+            [key]: { ...conv, messages: nextMsgs },
+          },
+        };
+      }
+      return state;
     }
     case "SELECT": {
       if (!action.key) return { ...state, selected: null };
@@ -194,11 +306,49 @@ function reduce(state: State, action: Action): State {
         ...state,
         draftMentions: { ...state.draftMentions, [action.key]: action.text },
       };
+    case "TYPING": {
+      const current = state.typing[action.key] ?? [];
+      const without = current.filter((u) => u !== action.from);
+      const nextUsers = action.typing ? [...without, action.from] : without;
+      if (nextUsers.length === current.length && !action.typing) return state;
+      return {
+        ...state,
+        typing: { ...state.typing, [action.key]: nextUsers },
+      };
+    }
+    case "PRESENCE":
+      if (state.presence[action.username] === action.status) return state;
+      return {
+        ...state,
+        presence: { ...state.presence, [action.username]: action.status },
+      };
     default:
       return state;
   }
 }
 
+function parseReactions(
+  raw: unknown,
+  me: string | null,
+): MessageReaction[] | undefined {
+  if (!Array.isArray(raw)) return undefined;
+  const reactions: MessageReaction[] = [];
+  for (const item of raw) {
+    if (!isRecord(item)) continue;
+    const emoji = getString(item, "emoji");
+    const count = getNumber(item, "count");
+    if (!emoji || typeof count !== "number") continue;
+    const users = getStringArray(item, "users") ?? [];
+    reactions.push({ emoji, count, reacted: me ? users.includes(me) : false });
+  }
+  return reactions;
+}
+
+function parseThreadRoot(raw: Record<string, unknown>): string | undefined {
+  const root = getNumber(raw, "thread-root");
+  return typeof root === "number" && root > 0 ? String(root) : undefined;
+}
+
 function parseMentions(text: string) {
   return text
     .split(",")
@@ -275,6 +425,8 @@ type API = {
   quitTopic: (topic: string) => Promise<void>;
   setDraftText: (key: ConversationKey, text: string) => void;
   setDraftMentions: (key: ConversationKey, text: string) => void;
+  notifyTyping: (key: ConversationKey) => void;
+  react: (messageId: string, emoji: string) => void;
 };
 
 const Ctx = createContext<API | null>(null);
@@ -292,6 +444,7 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
   const attemptRef = useRef(0);
   const meRef = useRef<string | null>(null);
   const connectWSRef = useRef<() => void>(() => {});
+  const lastTypingAtRef = useRef<Record<string, number>>({});
 
   useEffect(() => {
     meRef.current = state.me;
@@ -318,6 +471,45 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
     }
   }, []);
 
+  const handleChatMessage = useCallback((parsed: Record<string, unknown>) => {
+    // 确认收到服务端下行消息，未确认的消息会被重传
+    const serverId = getNumber(parsed, "id");
+    if (typeof serverId === "number" && serverId > 0) {
+      wsRef.current?.send(
+        JSON.stringify({ "message-type": "ack", "ack-id": serverId }),
+      );
+    }
+    const from = getString(parsed, "from") ?? "";
+    const content = getString(parsed, "content") ?? "";
+    const topic = getString(parsed, "topic") ?? "";
+    const to = getStringArray(parsed, "to");
+    const kind: ConversationKind = topic ? "topic" : "p2p";
+    const id = topic ? topic : from;
+    // summary 为服务端压缩的离线积压，作为系统提示展示
+    const isSummary = getString(parsed, "message-type") === "summary";
+    const chatMsg: ChatMessage = {
+      id:
+        typeof serverId === "number" && serverId > 0
+          ? String(serverId)
+          : crypto.randomUUID(),
+      at: Date.now(),
+      direction: isSummary ? "system" : "in",
+      from,
+      to,
+      topic: topic || undefined,
+      content,
+      // 离线期间被编辑或撤回的消息直接以新版本回放
+      edited: Boolean(getString(parsed, "edited-at")),
+      recalled: Boolean(getString(parsed, "recalled-at")),
+      reactions: parseReactions(parsed.reactions, meRef.current),
+      threadRoot: parseThreadRoot(parsed),
+      replyCount: isRecord(parsed.thread)
+        ? getNumber(parsed.thread, "reply-count")
+        : undefined,
+    };
+    dispatch({ type: "INBOUND_MSG", kind, id, msg: chatMsg });
+  }, []);
+
   const handleInbound = useCallback((raw: MessageEvent) => {
     const data = typeof raw.data === "string" ? raw.data : "";
     const parsed = safeJSONParse(data);
@@ -341,25 +533,77 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
       }
       return;
     }
-    if (mt === "message") {
+    if (mt === "presence") {
+      const payload = parsed.data;
+      if (!isRecord(payload)) return;
+      const username = getString(payload, "username");
+      const status = PRESENCE_STATUSES.find(
+        (s) => s === getString(payload, "status"),
+      );
+      if (!username || !status) return;
+      dispatch({ type: "PRESENCE", username, status });
+      return;
+    }
+    if (mt === "typing") {
       const from = getString(parsed, "from") ?? "";
-      const content = getString(parsed, "content") ?? "";
-      const topic = getString(parsed, "topic") ?? "";
-      const to = getStringArray(parsed, "to");
-      const kind: ConversationKind = topic ? "topic" : "p2p";
-      const id = topic ? topic : from;
-      const chatMsg: ChatMessage = {
-        id: crypto.randomUUID(),
-        at: Date.now(),
-        direction: "in",
-        from,
-        to,
-        topic: topic || undefined,
-        content,
-      };
-      dispatch({ type: "INBOUND_MSG", kind, id, msg: chatMsg });
+      const payload = parsed.data;
+      if (!from || !isRecord(payload)) return;
+      const topic = getString(payload, "topic") ?? "";
+      const key = topic ? convKey("topic", topic) : convKey("p2p", from);
+      dispatch({ type: "TYPING", key, from, typing: payload.typing === true });
+      return;
     }
-  }, []);
+    if (mt === "message-edited" || mt === "message-recalled") {
+      const payload = parsed.data;
+      if (!isRecord(payload)) return;
+      const messageId = getNumber(payload, "message-id");
+      if (typeof messageId !== "number") return;
+      const recalled = mt === "message-recalled";
+      dispatch({
+        type: "PATCH_MSG",
+        id: String(messageId),
+        content: recalled ? "" : (getString(payload, "content") ?? ""),
+        edited: recalled ? undefined : true,
+        recalled: recalled ? true : undefined,
+      });
+      return;
+    }
+    if (mt === "reaction") {
+      const payload = parsed.data;
+      if (!isRecord(payload)) return;
+      const messageId = getNumber(payload, "message-id");
+      const emoji = getString(payload, "emoji");
+      const count = getNumber(payload, "count");
+      if (typeof messageId !== "number" || !emoji || typeof count !== "number")
+        return;
+      // 只有自己的回应会改变 reacted 标记
+      const mine = getString(payload, "user") === meRef.current;
+      dispatch({
+        type: "REACTION",
+        id: String(messageId),
+        emoji,
+        count,
+        reacted: mine ? getString(payload, "action") === "add" : undefined,
+      });
+      return;
+    }
+    if (mt === "batch") {
+      // 离线回放的批量消息，按顺序逐条处理
+      const messages = parsed.messages;
+      if (!Array.isArray(messages)) return;
+      for (const item of messages) {
+        if (isRecord(item)) handleChatMessage(item);
+      }
+      return;
+    }
+    if (mt === "sync-complete") {
+      dispatch({ type: "SYNC_COMPLETE" });
+      return;
+    }
+    if (mt === "message") {
+      handleChatMessage(parsed);
+    }
+  }, [handleChatMessage]);
 
   const scheduleReconnect = useCallback(() => {
     if (state.auth !== "logged_in") return;
@@ -379,7 +623,10 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
     if (!sid) return;
 
     dispatch({ type: "WS_STATE", ws: "connecting" });
-    const ws = new WebSocket(wsURLWithSID("/api/ws", sid));
+    const url = new URL(wsURLWithSID("/api/ws", sid));
+    // 客户端会逐条 ack 下行消息，开启服务端的确认与重传
+    url.searchParams.set("ack", "1");
+    const ws = new WebSocket(url.toString());
     wsRef.current = ws;
 
     ws.onopen = () => {
@@ -518,6 +765,20 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
       dispatch({ type: "CONV_TOUCHED", key, at: Date.now(), preview: "" });
       dispatch({ type: "SELECT", key });
 
+      if (kind === "p2p") {
+        // 订阅对方在线状态，之后的变化通过 presence 消息推送
+        try {
+          const presence = await apiSubscribePresence(id);
+          dispatch({
+            type: "PRESENCE",
+            username: presence.username,
+            status: presence.status,
+          });
+        } catch {
+          // ignore
+        }
+      }
+
       if (kind === "topic") {
         try {
           await apiCreateTopic(id);
@@ -555,6 +816,7 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
             conv.kind === "topic"
               ? parseMentions(mentionsText ?? "")
               : undefined,
+          clientMsgId: crypto.randomUUID(),
         });
         const outMsg: ChatMessage = {
           id: crypto.randomUUID(),
@@ -568,6 +830,8 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
         };
         dispatch({ type: "ADD_MSG", key, msg: outMsg, unreadInc: false });
         dispatch({ type: "SET_DRAFT_TEXT", key, text: "" });
+        // 发送消息后服务端已结束输入状态，下次输入立即通知
+        delete lastTypingAtRef.current[key];
       } catch (err: unknown) {
         const e = asErrorMessage(err);
         if (e.status === 401) {
@@ -608,6 +872,51 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
     dispatch({ type: "SET_DRAFT_MENTIONS", key, text });
   }, []);
 
+  const notifyTyping = useCallback(
+    (key: ConversationKey) => {
+      const conv = state.conversations[key];
+      const ws = wsRef.current;
+      if (!conv || !ws || ws.readyState !== WebSocket.OPEN) return;
+      // 服务端同样限流，这里只避免每次按键都发送
+      const now = Date.now();
+      if (now - (lastTypingAtRef.current[key] ?? 0) < 2_000) return;
+      lastTypingAtRef.current[key] = now;
+      ws.send(
+        JSON.stringify(
+          conv.kind === "topic"
+            ? { "message-type": "typing", topic: conv.id }
+            : { "message-type": "typing", to: [conv.id] },
+        ),
+      );
+    },
+    [state.conversations],
+  );
+
+  const react = useCallback(
+    (messageId: string, emoji: string) => {
+      const ws = wsRef.current;
+      const serverId = Number(messageId);
+      if (!ws || ws.readyState !== WebSocket.OPEN || !serverId) return;
+      // 已回应的表情再次点击即取消
+      const reacted = Object.values(state.conversations).some((conv) =>
+        conv.messages.some(
+          (m) =>
+            m.id === messageId &&
+            m.reactions?.some((r) => r.emoji === emoji && r.reacted),
+        ),
+      );
+      ws.send(
+        JSON.stringify({
+          "message-type": "reaction",
+          "message-id": serverId,
+          emoji,
+          action: reacted ? "remove" : "add",
+        }),
+      );
+    },
+    [state.conversations],
+  );
+
   const api = useMemo<API>(
     () => ({
       state,
@@ -620,12 +929,16 @@ export function ImProvider({ children }: { children: React.ReactNode }) {
       quitTopic,
       setDraftText,
       setDraftMentions,
+      notifyTyping,
+      react,
     }),
     [
       joinTopic,
       login,
       logout,
+      notifyTyping,
       quitTopic,
+      react,
       select,
       send,
       setDraftMentions,
@@ -11,6 +11,17 @@ export interface ChatMessage {
   to?: string[]
   topic?: string
   content: string
+  edited?: boolean
+  recalled?: boolean
+  reactions?: MessageReaction[]
+  threadRoot?: string
+  replyCount?: number
+}
+
+export interface MessageReaction {
+  emoji: string
+  count: number
+  reacted?: boolean
 }
 
 export interface Conversation {
@@ -43,14 +54,146 @@ export interface WsAck {
 
 export interface DownMessage {
   'message-type': 'message'
+  id: number
+  'conversation-id': string
+  seq: number
   from: string
   to: string[]
   topic?: string
   'content-type': 'text/plain'
   content: string
+  'edited-at'?: string
+  'recalled-at'?: string
+  reactions?: (MessageReaction & { users: string[] })[]
+  'reply-to'?: number
+  'thread-root'?: number
+  thread?: {
+    'reply-count': number
+    'last-reply-at': string
+    participants: string[]
+  }
+}
+
+export interface DownSummary {
+  'message-type': 'summary'
+  id: number
+  'conversation-id': string
+  from: 'server'
+  to: string[]
+  topic: string
+  content: string
+  summary: {
+    count: number
+    'first-id': number
+    'last-id': number
+    since: string
+  }
+}
+
+export interface WsBatch {
+  'message-type': 'batch'
+  messages: (DownMessage | DownSummary)[]
+}
+
+export interface WsSyncComplete {
+  'message-type': 'sync-complete'
+  from: 'server'
+  to: string[]
+  data: {
+    total: number
+    conversations: {
+      'conversation-id': string
+      count: number
+      'last-seq': number
+    }[]
+  }
+}
+
+export interface WsMessageEdited {
+  'message-type': 'message-edited'
+  from: 'server'
+  to: string[]
+  data: {
+    'conversation-id': string
+    'message-id': number
+    'content-type': string
+    content: string
+    'edited-at': string
+  }
+}
+
+export interface WsMessageRecalled {
+  'message-type': 'message-recalled'
+  from: 'server'
+  to: string[]
+  data: {
+    'conversation-id': string
+    'message-id': number
+    'recalled-at': string
+  }
+}
+
+export interface WsReaction {
+  'message-type': 'reaction'
+  from: 'server'
+  to: string[]
+  data: {
+    'conversation-id': string
+    'message-id': number
+    emoji: string
+    user: string
+    action: 'add' | 'remove'
+    count: number
+    at: string
+  }
+}
+
+export interface WsTyping {
+  'message-type': 'typing'
+  from: string
+  to: string[]
+  data: {
+    'conversation-id': string
+    topic?: string
+    typing: boolean
+  }
+}
+
+export type PresenceStatus = 'online' | 'idle' | 'away' | 'dnd' | 'offline'
+
+export const PRESENCE_STATUSES: PresenceStatus[] = [
+  'online',
+  'idle',
+  'away',
+  'dnd',
+  'offline',
+]
+
+export interface Presence {
+  username: string
+  status: PresenceStatus
+  'status-text'?: string
+  'last-seen-at'?: string
+}
+
+export interface WsPresence {
+  'message-type': 'presence'
+  from: 'server'
+  to: string[]
+  data: Presence
 }
 
-export type WsInbound = WsPong | WsAck | DownMessage
+export type WsInbound =
+  | WsPong
+  | WsAck
+  | DownMessage
+  | WsBatch
+  | WsSyncComplete
+  | WsMessageEdited
+  | WsMessageRecalled
+  | WsReaction
+  | WsTyping
+  | WsPresence
 
 export function convKey(kind: ConversationKind, id: string): ConversationKey {
   return `${kind}:${id}`